@@ -2,27 +2,38 @@ package integ
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/valyala/fastjson"
 )
 
 type ManualContext interface {
+	// Stream opens a stream, returns ErrSkipStream if the stream is not selected
 	Stream(schema Schema) (ManualStreamContext, error)
 }
 
+// ErrSkipStream is returned when a stream is not part of the configured catalog
+var ErrSkipStream = fmt.Errorf("stream not selected")
+
 type ManualStreamContext interface {
 	EmitValues(arr []*fastjson.Value) error
 	Load(a, b any) error
 	EmitState(any) error
 	EmitLog(any) error
+	EmitEstimate(rows, bytes int64) error
+	Configured() ConfiguredStream
 }
 
 var _ ManualContext = &manualCtx{}
 var _ ManualStreamContext = &manualStreamCtx{}
 
 type manualCtx struct {
-	p        Proto
-	flushers []func() error
+	ctx       context.Context
+	p         Proto
+	flushers  []func() error
+	check     bool // stop at the first records, used by check
+	streams   []*manualStreamCtx
+	noRecover bool
 }
 
 func (m *manualCtx) Close() error {
@@ -38,9 +49,22 @@ func (m *manualCtx) Stream(schema Schema) (ManualStreamContext, error) {
 	sp, err := m.p.Open(schema)
 	if err != nil {
 		return nil, err
+	} else if sp == nil {
+		return nil, ErrSkipStream
 	}
 	m.flushers = append(m.flushers, sp.Flush)
-	return &manualStreamCtx{baseRunContext: makeBaseRunCtx(context.TODO(), schema, sp)}, nil
+	if m.check {
+		sp = validatorStream{StreamProto: sp}
+	}
+	c := &manualStreamCtx{baseRunContext: makeBaseRunCtx(m.ctx, schema, sp)}
+	c.noRecover = m.noRecover
+	// invalid records are dropped or fail the stream, dead letters are not supported for manual streams
+	if err := c.setup(streamSet{sp: sp}); err != nil {
+		return nil, err
+	}
+	m.flushers = append(m.flushers, c.report)
+	m.streams = append(m.streams, c)
+	return c, nil
 }
 
 type manualStreamCtx struct {
@@ -61,14 +85,39 @@ type Proto interface {
 	EmitStatus(v error) error // can we move this to Proto
 }
 
+// StreamStatus is the status of a stream in a sync
+type StreamStatus string
+
+const (
+	StreamStarted    StreamStatus = "STARTED"
+	StreamRunning    StreamStatus = "RUNNING"
+	StreamComplete   StreamStatus = "COMPLETE"
+	StreamIncomplete StreamStatus = "INCOMPLETE"
+)
+
+// StreamTracer is implemented by stream protos that report errors, estimates and the stream status as traces
+type StreamTracer interface {
+	// EmitError reports the error that failed the stream
+	EmitError(err error) error
+
+	// EmitEstimate reports the estimated number of records and bytes of the stream, 0 if unknown
+	EmitEstimate(rows, bytes int64) error
+
+	EmitStreamStatus(status StreamStatus) error
+}
+
 type StreamProto interface {
 	Load(config, state interface{}) error
 
 	EmitValues(arr []*fastjson.Value) error
 
+	// EmitState emits the state, pending records must be flushed before the state
 	EmitState(v interface{}) error
 
 	EmitLog(v interface{}) error
 
+	// Configured returns the sync configuration selected for the stream
+	Configured() ConfiguredStream
+
 	Flush() error
 }
@@ -0,0 +1,33 @@
+package integ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/valyala/fastjson"
+)
+
+var validatorOK = fmt.Errorf("validatorOK")
+
+// validatorStream stops the runner when the first records are emitted
+type validatorStream struct {
+	StreamProto
+}
+
+func (v validatorStream) EmitValues([]*fastjson.Value) error {
+	return validatorOK
+}
+
+func (v validatorStream) EmitState(interface{}) error {
+	return nil
+}
+
+// checkStream runs the stream until the first records are emitted
+func checkStream(ctx context.Context, runner runnerTyp, sp StreamProto) (err error) {
+	defer recoverPanic(!runner.noRecover, &err)
+	if err := runStream(ctx, runner, streamSet{sp: validatorStream{StreamProto: sp}}); err != nil && !errors.Is(err, validatorOK) {
+		return err
+	}
+	return nil
+}
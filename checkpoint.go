@@ -0,0 +1,49 @@
+package integ
+
+import "time"
+
+// checkpointer emits the registered cursor as state when the checkpoint policy is met
+type checkpointer struct {
+	records  int
+	interval time.Duration
+
+	cursor  interface{}
+	pending bool
+	count   int
+	last    time.Time
+}
+
+// CheckpointEvery sets the checkpoint policy. The cursor registered with SetCursor is emitted
+// every n records or every interval, whichever comes first. Zero disables the condition.
+func (r *baseRunContext) CheckpointEvery(records int, interval time.Duration) {
+	r.cp.records, r.cp.interval = records, interval
+	r.cp.last = time.Now()
+}
+
+// SetCursor registers the current state of the stream, it is emitted at the next checkpoint
+// and when the stream completes (unless EmitState is called after)
+func (r *baseRunContext) SetCursor(v interface{}) {
+	r.cp.cursor, r.cp.pending = v, true
+}
+
+// EmitState emits the state and resets the checkpoint policy
+func (r *baseRunContext) EmitState(v interface{}) error {
+	r.cp.pending, r.cp.count, r.cp.last = false, 0, time.Now()
+	return r.StreamProto.EmitState(v)
+}
+
+// checkpoint emits the pending cursor if the policy is met, or unconditionally if force is set
+func (r *baseRunContext) checkpoint(n int, force bool) error {
+	r.cp.count += n
+	if !r.cp.pending {
+		return nil
+	} else if force || r.cp.due() {
+		// the stream proto flushes the buffered records before the state is emitted
+		return r.EmitState(r.cp.cursor)
+	}
+	return nil
+}
+
+func (c *checkpointer) due() bool {
+	return (c.records > 0 && c.count >= c.records) || (c.interval > 0 && time.Since(c.last) >= c.interval)
+}
@@ -0,0 +1,70 @@
+// infer samples the records of a source and prints the inferred json schema and go struct per stream
+//
+//	infer -config config.json [-limit 100] [-stream orders] shopify
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/ajzo90/go-integ"
+	"github.com/ajzo90/go-integ/integrations/pokeapi"
+	"github.com/ajzo90/go-integ/integrations/shopify"
+	"github.com/ajzo90/go-integ/integrations/storm"
+)
+
+type inferrer interface {
+	InferSchemas(ctx context.Context, rd io.Reader, limit int, streams ...string) ([]integ.InferredSchema, error)
+}
+
+var sources = map[string]inferrer{
+	"shopify": shopify.Source,
+	"storm":   storm.Loader,
+	"poke":    pokeapi.Poke,
+}
+
+func main() {
+	config := flag.String("config", "", "config file")
+	limit := flag.Int("limit", 100, "records sampled per stream, 0 samples all records")
+	stream := flag.String("stream", "", "stream to sample (all streams by default)")
+	flag.Parse()
+
+	src, ok := sources[flag.Arg(0)]
+	if !ok {
+		log.Fatalf("unknown source '%s'", flag.Arg(0))
+	}
+
+	var input bytes.Buffer
+	if *config != "" {
+		b, err := os.ReadFile(*config)
+		if err != nil {
+			log.Fatal(err)
+		} else if err := json.NewEncoder(&input).Encode(map[string]interface{}{"type": integ.CONFIG, "config": json.RawMessage(b)}); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var streams []string
+	if *stream != "" {
+		streams = append(streams, *stream)
+	}
+
+	schemas, err := src.InferSchemas(context.Background(), &input, *limit, streams...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, s := range schemas {
+		fmt.Printf("// %s: %d records\n", s.Stream, s.Records)
+		if s.Err != nil {
+			fmt.Printf("// error: %s\n", s.Err.Error())
+		}
+		fmt.Println(s.Schema.Indented())
+		fmt.Println(s.GoStruct)
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+func TestValidateLoaders(t *testing.T) {
+	for name, loader := range loaders {
+		v, ok := loader.(interface{ Validate() error })
+		if !ok {
+			continue
+		} else if err := v.Validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package integ
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+var jsonNumberRe = regexp.MustCompile(`^-?(0|[1-9]\d*)(\.\d+)?([eE][+-]?\d+)?$`)
+
+// dateTimeLayouts are the accepted layouts of date-time strings, values without zone are assumed to be UTC
+var dateTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05Z07:00", "2006-01-02 15:04:05", "2006-01-02"}
+
+// coercer converts record values to the types declared in the json schema of the stream.
+// Numeric strings are parsed as numbers, "true"/"false" as booleans, date-times are normalized
+// to RFC3339 UTC and scalars are wrapped in arrays where an array is expected
+type coercer struct {
+	stream string
+	schema *jsonSchema
+	arena  fastjson.Arena
+	stats  map[string]int
+}
+
+func newCoercer(schema Schema) (*coercer, error) {
+	if !schema.CoerceTypes {
+		return nil, nil
+	}
+	s, err := newJsonSchema(schema.JsonSchema)
+	if err != nil {
+		return nil, err
+	}
+	return &coercer{stream: schema.Name, schema: s, stats: map[string]int{}}, nil
+}
+
+// coerceValues coerces the records in place, the converted values are valid until the next call
+func (c *coercer) coerceValues(values []*fastjson.Value) {
+	c.arena.Reset()
+	for i, v := range values {
+		values[i] = c.coerce(c.schema, v)
+	}
+}
+
+func (c *coercer) coerce(s *jsonSchema, v *fastjson.Value) *fastjson.Value {
+	if s == nil {
+		return v
+	} else if !s.hasType(v) {
+		return c.convert(s, v)
+	}
+
+	switch v.Type() {
+	case fastjson.TypeObject:
+		o := v.GetObject()
+		var keys []string
+		var changed []*fastjson.Value
+		o.Visit(func(key []byte, child *fastjson.Value) {
+			if nv := c.coerce((validator{}).property(s, string(key)), child); nv != child {
+				keys, changed = append(keys, string(key)), append(changed, nv)
+			}
+		})
+		for i, key := range keys {
+			o.Set(key, changed[i])
+		}
+	case fastjson.TypeArray:
+		for i, item := range v.GetArray() {
+			if nv := c.coerce(s.Items, item); nv != item {
+				v.SetArrayItem(i, nv)
+			}
+		}
+	case fastjson.TypeString:
+		if s.Format == "date-time" {
+			return c.dateTime(v)
+		}
+	}
+	return v
+}
+
+// convert converts v to the first type in the schema it can be converted to, v is returned otherwise
+func (c *coercer) convert(s *jsonSchema, v *fastjson.Value) *fastjson.Value {
+	for _, typ := range s.Type {
+		switch typ {
+		case "integer", "number":
+			str := strings.TrimSpace(string(v.GetStringBytes()))
+			if v.Type() != fastjson.TypeString || !jsonNumberRe.MatchString(str) {
+				continue
+			}
+			nv := c.arena.NewNumberString(str)
+			if f, _ := nv.Float64(); typ == "integer" && f != math.Trunc(f) {
+				continue
+			}
+			c.stats["number"]++
+			return nv
+		case "boolean":
+			if v.Type() != fastjson.TypeString {
+				continue
+			} else if str := string(v.GetStringBytes()); str == "true" {
+				c.stats["boolean"]++
+				return c.arena.NewTrue()
+			} else if str == "false" {
+				c.stats["boolean"]++
+				return c.arena.NewFalse()
+			}
+		case "array":
+			if v.Type() == fastjson.TypeNull {
+				continue
+			}
+			arr := c.arena.NewArray()
+			arr.SetArrayItem(0, c.coerce(s.Items, v))
+			c.stats["array"]++
+			return arr
+		}
+	}
+	return v
+}
+
+func (c *coercer) dateTime(v *fastjson.Value) *fastjson.Value {
+	str := string(v.GetStringBytes())
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.Parse(layout, str); err == nil {
+			if out := t.UTC().Format(time.RFC3339Nano); out != str {
+				c.stats["date-time"]++
+				return c.arena.NewString(out)
+			}
+			return v
+		}
+	}
+	return v
+}
+
+// report logs the number of coerced values by kind
+func (c *coercer) report(sp StreamProto) error {
+	var kinds []string
+	var total int
+	for k, n := range c.stats {
+		kinds, total = append(kinds, fmt.Sprintf("%s: %d", k, n)), total+n
+	}
+	if total == 0 {
+		return nil
+	}
+	sort.Strings(kinds)
+	return sp.EmitLog(fmt.Sprintf("%s: %d values coerced (%s)", c.stream, total, strings.Join(kinds, ", ")))
+}
@@ -0,0 +1,326 @@
+package integ
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+// DbTable describes the table read by EmitTable
+type DbTable struct {
+	// Name of the table, optionally qualified ("schema.table")
+	Name string
+	// ChunkSize is the number of rows per query, defaults to 1000
+	ChunkSize int
+	// Placeholder returns the bind parameter i (1-based), defaults to "?"
+	Placeholder func(i int) string
+}
+
+// DollarPlaceholder is the placeholder used by postgres ($1, $2, ...)
+func DollarPlaceholder(i int) string {
+	return "$" + strconv.Itoa(i)
+}
+
+func questionPlaceholder(int) string {
+	return "?"
+}
+
+// dbState is the state of incremental db streams, the key values of the last emitted row
+type dbState struct {
+	Cursor []interface{} `json:"cursor"`
+}
+
+type dbRunContext struct {
+	baseRunContext
+	arena fastjson.Arena
+}
+
+func newDbRunCtx(ctx context.Context, schema Schema, sp StreamProto) *dbRunContext {
+	return &dbRunContext{baseRunContext: makeBaseRunCtx(ctx, schema, sp)}
+}
+
+func (r *dbRunContext) EmitTable(db *sql.DB, table DbTable) error {
+	if table.ChunkSize <= 0 {
+		table.ChunkSize = 1000
+	}
+	if table.Placeholder == nil {
+		table.Placeholder = questionPlaceholder
+	}
+
+	// incremental streams are ordered by the cursor, and all streams by the primary key to paginate
+	var keyFields = r.schema.PrimaryKey
+	if r.schema.Incremental {
+		keyFields = append(append([]FieldDef{}, r.schema.OrderByKey...), r.schema.PrimaryKey...)
+	}
+	keys, err := columns(keyFields)
+	if err != nil {
+		return err
+	}
+
+	var last []interface{}
+	if r.schema.Incremental {
+		if last, err = r.loadCursor(len(keys)); err != nil {
+			return err
+		}
+	}
+
+	fields := Keys(r.schema.JsonSchema) // the columns are top level fields
+	for _, k := range keys {
+		if !contains(fields, k) {
+			fields = append(fields, k)
+		}
+	}
+
+	for {
+		query, args := selectQuery(table, fields, keys, last)
+		n, err := r.emitRows(db, query, args, keys, table.ChunkSize, &last)
+		if err != nil {
+			return err
+		} else if r.schema.Incremental && n > 0 && len(keys) > 0 {
+			if err := r.EmitState(newDbState(last)); err != nil {
+				return err
+			}
+		}
+		if n < table.ChunkSize || len(keys) == 0 {
+			return nil
+		}
+	}
+}
+
+func (r *dbRunContext) loadCursor(n int) ([]interface{}, error) {
+	var state struct {
+		Cursor []json.RawMessage `json:"cursor"`
+	}
+	if err := r.Load(nil, &state); err != nil {
+		return nil, err
+	} else if len(state.Cursor) == 0 {
+		return nil, nil
+	} else if len(state.Cursor) != n {
+		return nil, fmt.Errorf("invalid cursor state, expected %d values got %d", n, len(state.Cursor))
+	}
+
+	var cursor = make([]interface{}, n)
+	for i, raw := range state.Cursor {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&cursor[i]); err != nil {
+			return nil, err
+		} else if str, ok := cursor[i].(string); ok {
+			// timestamps are passed as time.Time to let the driver format them
+			if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+				cursor[i] = t
+			}
+		} else if num, ok := cursor[i].(json.Number); !ok {
+			continue
+		} else if v, err := num.Int64(); err == nil {
+			cursor[i] = v
+		} else if cursor[i], err = num.Float64(); err != nil {
+			return nil, err
+		}
+	}
+	return cursor, nil
+}
+
+// emitRows executes the query and emit the rows in batches of chunkSize, the key values of the last row are stored in last
+func (r *dbRunContext) emitRows(db *sql.DB, query string, args []interface{}, keys []string, chunkSize int, last *[]interface{}) (int, error) {
+	rows, err := db.QueryContext(r.ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	var keyIdx = make([]int, len(keys))
+	for i, k := range keys {
+		if keyIdx[i] = columnIndex(cols, k); keyIdx[i] < 0 {
+			return 0, fmt.Errorf("key column %s is not in the result columns %v", k, cols)
+		}
+	}
+
+	var values = make([]interface{}, len(cols))
+	var ptrs = make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	var n int
+	var out []*fastjson.Value
+	r.arena.Reset()
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return 0, err
+		}
+		o := r.arena.NewObject()
+		for i, col := range cols {
+			o.Set(col, dbValue(&r.arena, values[i]))
+		}
+		out = append(out, o)
+		n++
+
+		*last = make([]interface{}, len(keys))
+		for i, idx := range keyIdx {
+			(*last)[i] = values[idx]
+		}
+
+		// tables without keys are read in one query, the rows are emitted in batches
+		if len(out) >= chunkSize {
+			if err := r.EmitValues(out); err != nil {
+				return 0, err
+			}
+			out = out[:0]
+			r.arena.Reset()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return n, r.EmitValues(out)
+}
+
+// columnIndex returns the index of the column, case-insensitive if there is no exact match. -1 if not found
+func columnIndex(cols []string, name string) int {
+	if i := indexOf(cols, name); i >= 0 {
+		return i
+	}
+	for i, col := range cols {
+		if strings.EqualFold(col, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// selectQuery builds a keyset paginated query, the rows after the keys values in last are selected
+func selectQuery(table DbTable, fields, keys []string, last []interface{}) (string, []interface{}) {
+	var b strings.Builder
+	var args []interface{}
+
+	b.WriteString("SELECT ")
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(quoteIdent(f))
+	}
+	b.WriteString(" FROM ")
+	b.WriteString(quoteIdent(table.Name))
+
+	if len(last) > 0 {
+		// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...
+		b.WriteString(" WHERE ")
+		for i := range keys {
+			if i > 0 {
+				b.WriteString(" OR ")
+			}
+			b.WriteString("(")
+			for j := 0; j <= i; j++ {
+				op := " = "
+				if j == i {
+					op = " > "
+				}
+				if j > 0 {
+					b.WriteString(" AND ")
+				}
+				args = append(args, last[j])
+				b.WriteString(quoteIdent(keys[j]) + op + table.Placeholder(len(args)))
+			}
+			b.WriteString(")")
+		}
+	}
+
+	if len(keys) > 0 {
+		b.WriteString(" ORDER BY ")
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(quoteIdent(k))
+		}
+		b.WriteString(" LIMIT " + strconv.Itoa(table.ChunkSize))
+	}
+	return b.String(), args
+}
+
+func quoteIdent(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = `"` + strings.ReplaceAll(p, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+func columns(fields []FieldDef) ([]string, error) {
+	var out []string
+	for _, f := range fields {
+		if len(f.Path) != 1 {
+			return nil, fmt.Errorf("invalid db column %v, nested fields are not supported", f.Path)
+		} else if !contains(out, f.Path[0]) {
+			out = append(out, f.Path[0])
+		}
+	}
+	return out, nil
+}
+
+func dbValue(a *fastjson.Arena, v interface{}) *fastjson.Value {
+	switch t := v.(type) {
+	case nil:
+		return a.NewNull()
+	case int64:
+		return a.NewNumberString(strconv.FormatInt(t, 10))
+	case float64:
+		return a.NewNumberFloat64(t)
+	case bool:
+		if t {
+			return a.NewTrue()
+		}
+		return a.NewFalse()
+	case []byte:
+		return a.NewStringBytes(t)
+	case string:
+		return a.NewString(t)
+	case time.Time:
+		return a.NewString(t.UTC().Format(time.RFC3339Nano))
+	default:
+		return a.NewString(fmt.Sprint(t))
+	}
+}
+
+// newDbState converts the scanned key values to values that survive the json round trip of the state
+func newDbState(last []interface{}) dbState {
+	var cursor = make([]interface{}, len(last))
+	for i, v := range last {
+		switch t := v.(type) {
+		case []byte:
+			cursor[i] = string(t)
+		case time.Time:
+			cursor[i] = t.UTC().Format(time.RFC3339Nano)
+		default:
+			cursor[i] = t
+		}
+	}
+	return dbState{Cursor: cursor}
+}
+
+func contains(arr []string, s string) bool {
+	return indexOf(arr, s) >= 0
+}
+
+func indexOf(arr []string, s string) int {
+	for i, v := range arr {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
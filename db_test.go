@@ -0,0 +1,230 @@
+package integ_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ajzo90/go-integ"
+)
+
+// fakeDb is an in-memory database that evaluates the keyset paginated queries of EmitTable:
+// SELECT "a", "b" FROM "t" WHERE ("a" > ?) OR ("a" = ? AND "b" > ?) ORDER BY "a", "b" LIMIT n
+type fakeDb struct {
+	tables  map[string]fakeTable
+	queries []string
+}
+
+type fakeTable struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+var selectRe = regexp.MustCompile(`^SELECT (.+) FROM "(\w+)"(?: WHERE (.+?))?(?: ORDER BY (.+) LIMIT (\d+))?$`)
+
+// openDb opens the fake database, the queries are recorded in db.queries
+func openDb(t *testing.T, tables map[string]fakeTable) (*sql.DB, *fakeDb) {
+	t.Helper()
+	f := &fakeDb{tables: tables}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { _ = db.Close() })
+	return db, f
+}
+
+func (f *fakeDb) Connect(context.Context) (driver.Conn, error) { return f, nil }
+func (f *fakeDb) Driver() driver.Driver                        { return nil }
+func (f *fakeDb) Prepare(string) (driver.Stmt, error)          { return nil, fmt.Errorf("not supported") }
+func (f *fakeDb) Close() error                                 { return nil }
+func (f *fakeDb) Begin() (driver.Tx, error)                    { return nil, fmt.Errorf("not supported") }
+
+func (f *fakeDb) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	f.queries = append(f.queries, query)
+	m := selectRe.FindStringSubmatch(query)
+	if m == nil {
+		return nil, fmt.Errorf("unexpected query %s", query)
+	}
+	table, ok := f.tables[m[2]]
+	if !ok {
+		return nil, fmt.Errorf("no table %s", m[2])
+	}
+	index := func(col string) int {
+		for i, c := range table.cols {
+			if `"`+c+`"` == col {
+				return i
+			}
+		}
+		return -1
+	}
+
+	var out = &fakeRows{}
+	for _, col := range strings.Split(m[1], ", ") {
+		out.cols = append(out.cols, strings.Trim(col, `"`))
+	}
+
+	for _, row := range table.rows {
+		if m[3] == "" || matchWhere(m[3], row, index, args) {
+			out.rows = append(out.rows, project(row, out.cols, index))
+		}
+	}
+
+	if m[4] != "" {
+		var keys []int
+		for _, k := range strings.Split(m[4], ", ") {
+			keys = append(keys, indexOf(out.cols, strings.Trim(k, `"`)))
+		}
+		sort.SliceStable(out.rows, func(i, j int) bool {
+			for _, k := range keys {
+				if c := compare(out.rows[i][k], out.rows[j][k]); c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+		if limit, _ := strconv.Atoi(m[5]); len(out.rows) > limit {
+			out.rows = out.rows[:limit]
+		}
+	}
+	return out, nil
+}
+
+// matchWhere evaluates the OR of AND conditions `"col" op ?`, the args are bound in order
+func matchWhere(where string, row []driver.Value, index func(string) int, args []driver.NamedValue) bool {
+	var arg int
+	var match bool
+	for _, clause := range strings.Split(where, " OR ") {
+		all := true
+		for _, cond := range strings.Split(strings.Trim(clause, "()"), " AND ") {
+			parts := strings.Fields(cond)
+			c := compare(row[index(parts[0])], args[arg].Value)
+			arg++
+			all = all && ((parts[1] == "=" && c == 0) || (parts[1] == ">" && c > 0))
+		}
+		match = match || all
+	}
+	return match
+}
+
+func project(row []driver.Value, cols []string, index func(string) int) []driver.Value {
+	var out = make([]driver.Value, len(cols))
+	for i, col := range cols {
+		out[i] = row[index(`"`+col+`"`)]
+	}
+	return out
+}
+
+func compare(a, b driver.Value) int {
+	switch a := a.(type) {
+	case int64:
+		return int(a - b.(int64))
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	panic(fmt.Sprintf("unsupported value %T", a))
+}
+
+func indexOf(arr []string, s string) int {
+	for i, v := range arr {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// records returns the data of the record messages in the airbyte output
+func records(t *testing.T, out string) []string {
+	t.Helper()
+	var o []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var msg struct {
+			Type   string `json:"type"`
+			Record struct {
+				Data json.RawMessage `json:"data"`
+			} `json:"record"`
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatal(err)
+		} else if msg.Type == "RECORD" {
+			o = append(o, string(msg.Record.Data))
+		}
+	}
+	return o
+}
+
+func TestDbStream(t *testing.T) {
+	db, fake := openDb(t, map[string]fakeTable{
+		// ties on updated are paginated by id
+		"items": {cols: []string{"updated", "id", "name"}, rows: [][]driver.Value{
+			{int64(1), int64(1), "a"}, {int64(1), int64(2), "b"}, {int64(1), int64(3), "c"}, {int64(2), int64(1), "d"},
+			{int64(2), int64(4), "e"}, {int64(3), int64(2), "f"}, {int64(0), int64(9), "g"},
+		}},
+	})
+
+	src := integ.NewSource(struct{}{}).
+		DbStream(integ.Incremental("items", struct {
+			Updated int    `json:"updated"`
+			Id      int    `json:"id"`
+			Name    string `json:"name"`
+		}{}).OrderBy(integ.Field("updated")).Primary(integ.Field("id")), integ.DbRunnerFunc(func(ctx integ.DbContext) error {
+			return ctx.EmitTable(db, integ.DbTable{Name: "items", ChunkSize: 2})
+		}))
+
+	out := handle(t, src, integ.CmdRead, `{"type":"CONFIG","config":{}}`, `{"type":"STATE","stream":"items","state":{"cursor":[1,2]}}`)
+	got := strings.Join(records(t, out), " ")
+	const expected = `{"id":3,"name":"c","updated":1} {"id":1,"name":"d","updated":2} {"id":4,"name":"e","updated":2} {"id":2,"name":"f","updated":3}`
+	if got != expected {
+		t.Errorf("expected the rows after the state in key order\n%s, got\n%s", expected, got)
+	} else if !strings.Contains(out, `"stream_state":{"cursor":[3,2]}`) {
+		t.Errorf("expected state after the last chunk: %s", out)
+	}
+
+	const query = `SELECT "id", "name", "updated" FROM "items" WHERE ("updated" > ?) OR ("updated" = ? AND "id" > ?) ORDER BY "updated", "id" LIMIT 2`
+	if len(fake.queries) != 3 || fake.queries[0] != query {
+		t.Errorf("expected 3 queries starting with %s, got %v", query, fake.queries)
+	}
+}
+
+func TestDbStreamWithoutKeys(t *testing.T) {
+	db, fake := openDb(t, map[string]fakeTable{
+		"events": {cols: []string{"name"}, rows: [][]driver.Value{{"a"}, {"b"}, {"c"}, {"d"}, {"e"}}},
+	})
+
+	src := integ.NewSource(struct{}{}).
+		DbStream(integ.NonIncremental("events", struct {
+			Name string `json:"name"`
+		}{}), integ.DbRunnerFunc(func(ctx integ.DbContext) error {
+			return ctx.EmitTable(db, integ.DbTable{Name: "events", ChunkSize: 2})
+		}))
+
+	out := handle(t, src, integ.CmdRead, `{"type":"CONFIG","config":{}}`)
+	if got := strings.Join(records(t, out), " "); got != `{"name":"a"} {"name":"b"} {"name":"c"} {"name":"d"} {"name":"e"}` {
+		t.Errorf("unexpected records %s", got)
+	} else if len(fake.queries) != 1 {
+		t.Errorf("expected one query, got %v", fake.queries)
+	}
+}
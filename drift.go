@@ -0,0 +1,159 @@
+package integ
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/valyala/fastjson"
+)
+
+// driftDetector compares the shape of the emitted records with the json schema of the stream. New properties,
+// properties that are always missing and type changes are reported when the stream completes
+type driftDetector struct {
+	stream  string
+	schema  *jsonSchema
+	max     int
+	records int
+	seen    map[string]bool
+	unknown map[string]bool
+	changes map[string]*typeChange
+}
+
+// typeChange is a property with values of types not allowed by the schema
+type typeChange struct {
+	expected []string
+	observed map[string]bool
+}
+
+func newDriftDetector(schema Schema) (*driftDetector, error) {
+	if !schema.DriftDetection {
+		return nil, nil
+	}
+	s, err := newJsonSchema(schema.JsonSchema)
+	if err != nil {
+		return nil, err
+	}
+	return &driftDetector{
+		stream:  schema.Name,
+		schema:  s,
+		max:     schema.DriftThreshold,
+		seen:    map[string]bool{},
+		unknown: map[string]bool{},
+		changes: map[string]*typeChange{},
+	}, nil
+}
+
+func (d *driftDetector) observeValues(values []*fastjson.Value) {
+	d.records += len(values)
+	for _, v := range values {
+		d.observe(d.schema, v, "")
+	}
+}
+
+func (d *driftDetector) observe(s *jsonSchema, v *fastjson.Value, path string) {
+	d.seen[path] = true
+	if !s.hasType(v) {
+		if d.changes[path] == nil {
+			d.changes[path] = &typeChange{expected: s.Type, observed: map[string]bool{}}
+		}
+		d.changes[path].observed[jsonType(v)] = true
+		return
+	}
+
+	switch v.Type() {
+	case fastjson.TypeObject:
+		if s.Properties == nil {
+			return // any object
+		}
+		v.GetObject().Visit(func(key []byte, child *fastjson.Value) {
+			if prop := (validator{}).property(s, string(key)); prop != nil {
+				d.observe(prop, child, join(path, string(key)))
+			} else {
+				d.unknown[join(path, string(key))] = true
+			}
+		})
+	case fastjson.TypeArray:
+		if s.Items != nil {
+			for _, item := range v.GetArray() {
+				d.observe(s.Items, item, path+"[]")
+			}
+		}
+	}
+}
+
+// missing returns the properties in the schema never seen in the records
+func (d *driftDetector) missing(s *jsonSchema, path string, out []string) []string {
+	if s == nil || !d.seen[path] {
+		return out
+	}
+	for k, prop := range s.Properties {
+		if k == ".*" {
+			continue
+		} else if p := join(path, k); !d.seen[p] {
+			out = append(out, p)
+		} else {
+			out = d.missing(prop, p, out)
+		}
+	}
+	return d.missing(s.Items, path+"[]", out)
+}
+
+// report logs the drift, an error is returned if the number of changes exceeds the threshold
+func (d *driftDetector) report(sp StreamProto) error {
+	if d.records == 0 {
+		return nil
+	}
+
+	var added, missing, changed []string
+	for p := range d.unknown {
+		added = append(added, p)
+	}
+	missing = d.missing(d.schema, "", nil)
+	for p, c := range d.changes {
+		var observed []string
+		for t := range c.observed {
+			observed = append(observed, t)
+		}
+		sort.Strings(observed)
+		changed = append(changed, fmt.Sprintf("%s (expected %s, got %s)", p, strings.Join(c.expected, "|"), strings.Join(observed, "|")))
+	}
+
+	n := len(added) + len(missing) + len(changed)
+	if n == 0 {
+		return nil
+	}
+	sort.Strings(added)
+	sort.Strings(missing)
+	sort.Strings(changed)
+
+	var parts []string
+	for _, p := range []struct {
+		name   string
+		values []string
+	}{{"new properties", added}, {"missing properties", missing}, {"type changes", changed}} {
+		if len(p.values) > 0 {
+			parts = append(parts, fmt.Sprintf("%s [%s]", p.name, strings.Join(p.values, ", ")))
+		}
+	}
+	if err := sp.EmitLog(fmt.Sprintf("%s: schema drift in %d records: %s", d.stream, d.records, strings.Join(parts, "; "))); err != nil {
+		return err
+	} else if d.max >= 0 && n > d.max {
+		return fmt.Errorf("%s: schema drift exceeds the threshold, %d changes (max %d)", d.stream, n, d.max)
+	}
+	return nil
+}
+
+// jsonType is the json schema type of v, integral numbers are integers
+func jsonType(v *fastjson.Value) string {
+	switch v.Type() {
+	case fastjson.TypeNumber:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return typeName(v)
+	}
+}
@@ -0,0 +1,186 @@
+package integ
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorCategory classifies the errors of a sync, it tells if the sync can be retried and who has to act
+type ErrorCategory string
+
+const (
+	// CategorySystem is a bug or an unexpected response (invalid json), the default category
+	CategorySystem ErrorCategory = "system"
+	// CategoryConfig is an invalid config, the sync fails until the config is changed
+	CategoryConfig ErrorCategory = "config"
+	// CategoryAuth is invalid credentials or missing permissions (http 401/403)
+	CategoryAuth ErrorCategory = "auth"
+	// CategoryTransient is a temporary failure of the api (http 5xx, timeouts), the sync can be retried
+	CategoryTransient ErrorCategory = "transient"
+	// CategoryRateLimited is a rate limit of the api (http 429), the sync can be retried later
+	CategoryRateLimited ErrorCategory = "rate_limited"
+)
+
+// Retryable returns true if a sync failing with an error of the category can be retried without changes
+func (c ErrorCategory) Retryable() bool {
+	return c == CategoryTransient || c == CategoryRateLimited
+}
+
+// categoryError is an error with a category, see Category
+type categoryError struct {
+	category   ErrorCategory
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *categoryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categoryError) Unwrap() error {
+	return e.err
+}
+
+func withCategory(category ErrorCategory, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &categoryError{category: category, err: err}
+}
+
+// ConfigError marks err as caused by the config (invalid values, unknown account).
+// The sync fails until the config is changed, it is not retried
+func ConfigError(err error) error {
+	return withCategory(CategoryConfig, err)
+}
+
+// AuthError marks err as caused by invalid credentials or missing permissions
+func AuthError(err error) error {
+	return withCategory(CategoryAuth, err)
+}
+
+// TransientError marks err as a temporary failure, the sync can be retried
+func TransientError(err error) error {
+	return withCategory(CategoryTransient, err)
+}
+
+// RateLimitedError marks err as caused by a rate limit, the sync can be retried after retryAfter (0 if unknown)
+func RateLimitedError(err error, retryAfter time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &categoryError{category: CategoryRateLimited, err: err, retryAfter: retryAfter}
+}
+
+// SystemError marks err as a bug or an unexpected response
+func SystemError(err error) error {
+	return withCategory(CategorySystem, err)
+}
+
+// Category returns the category of err, the outermost category if err is wrapped multiple times. Aggregated
+// errors are retryable only if all errors are retryable, otherwise config wins over auth and auth over system.
+// Deadlines and network timeouts are transient, errors without category are system errors
+func Category(err error) ErrorCategory {
+	var e *categoryError
+	var list errorList
+	var netErr net.Error
+	if errors.As(err, &e) {
+		return e.category
+	} else if errors.As(err, &list) && len(list) > 0 {
+		var category = Category(list[0])
+		for _, err := range list[1:] {
+			if c := Category(err); categoryRank[c] > categoryRank[category] {
+				category = c
+			}
+		}
+		return category
+	} else if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return CategoryTransient
+	}
+	return CategorySystem
+}
+
+// categoryRank decides the category of aggregated errors, the highest rank wins
+var categoryRank = map[ErrorCategory]int{
+	CategoryTransient:   1,
+	CategoryRateLimited: 2,
+	CategorySystem:      3,
+	CategoryAuth:        4,
+	CategoryConfig:      5,
+}
+
+// categorized returns true if err has a category, explicitly or as a transient error
+func categorized(err error) bool {
+	var e *categoryError
+	return errors.As(err, &e) || Category(err) != CategorySystem
+}
+
+// RetryAfter returns the delay of a rate limited error, 0 if unknown. The longest delay of aggregated errors,
+// 0 if any of them is not retryable
+func RetryAfter(err error) time.Duration {
+	var e *categoryError
+	var list errorList
+	if errors.As(err, &e) {
+		return e.retryAfter
+	} else if errors.As(err, &list) && Category(list).Retryable() {
+		var max time.Duration
+		for _, err := range list {
+			if d := RetryAfter(err); d > max {
+				max = d
+			}
+		}
+		return max
+	}
+	return 0
+}
+
+// HTTPError categorizes the error of a http response by the status code: 401/403 are auth errors,
+// 429 is rate limited (with the Retry-After header) and 5xx are transient. Other status codes are system errors
+func HTTPError(resp *http.Response, err error) error {
+	if err == nil {
+		err = fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	switch code := resp.StatusCode; {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return AuthError(err)
+	case code == http.StatusTooManyRequests:
+		return RateLimitedError(err, retryAfterHeader(resp.Header.Get("Retry-After")))
+	case code >= 500:
+		return TransientError(err)
+	default:
+		return SystemError(err)
+	}
+}
+
+// retryAfterHeader parses the Retry-After header, in seconds or as a http date
+func retryAfterHeader(s string) time.Duration {
+	if s == "" {
+		return 0
+	} else if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(sec) * time.Second
+	} else if t, err := http.ParseTime(s); err == nil && time.Until(t) > 0 {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// httpStatus is the status code of the server response for err
+func httpStatus(err error) int {
+	switch Category(err) {
+	case CategoryConfig:
+		return http.StatusBadRequest
+	case CategoryAuth:
+		return http.StatusUnauthorized
+	case CategoryRateLimited:
+		return http.StatusTooManyRequests
+	case CategoryTransient:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,130 @@
+package integ_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ajzo90/go-integ"
+	"github.com/ajzo90/go-integ/pkg/airbyte"
+	"github.com/ajzo90/go-requests"
+)
+
+func TestErrorCategory(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/401":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/429":
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/503":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/201":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":1}`))
+		case "/invalid":
+			_, _ = w.Write([]byte(`{"data":[`))
+		}
+	}))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		path       string
+		category   integ.ErrorCategory
+		retryAfter time.Duration
+	}{
+		{"/401", integ.CategoryAuth, 0},
+		{"/429", integ.CategoryRateLimited, 2 * time.Second},
+		{"/503", integ.CategoryTransient, 0},
+		{"/invalid", integ.CategorySystem, 0},
+	} {
+		req := requests.New(srv.URL + c.path).Extended().Doer(integ.CategorizeErrors(http.DefaultClient)).Clone()
+		_, err := req.ExecJSON()
+		if err == nil {
+			t.Errorf("%s: expected error", c.path)
+		} else if got := integ.Category(err); got != c.category {
+			t.Errorf("%s: expected %s, got %s (%v)", c.path, c.category, got, err)
+		} else if got := integ.RetryAfter(err); got != c.retryAfter {
+			t.Errorf("%s: expected retry after %s, got %s", c.path, c.retryAfter, got)
+		}
+	}
+
+	req := requests.New(srv.URL + "/201").Extended().Doer(integ.CategorizeErrors(http.DefaultClient)).Clone()
+	if resp, err := req.ExecJSON(); err != nil {
+		t.Errorf("expected 201 to succeed, got %v", err)
+	} else if resp.Int("id") != 1 {
+		t.Errorf("unexpected response %v", resp.Body())
+	}
+
+	if err := fmt.Errorf("load: %w", integ.AuthError(fmt.Errorf("invalid key"))); integ.Category(err) != integ.CategoryAuth {
+		t.Errorf("expected wrapped auth error")
+	} else if integ.Category(err).Retryable() || !integ.CategoryTransient.Retryable() {
+		t.Errorf("unexpected retryable")
+	}
+}
+
+func TestHandlerStatus(t *testing.T) {
+	type config struct {
+		Key string `json:"key"`
+	}
+	src := integ.NewSource(config{}).
+		HttpStream(integ.NonIncremental("users", struct{}{}), integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+			return nil
+		}))
+
+	failing := integ.NewSource(config{}).
+		HttpStream(integ.NonIncremental("users", struct{}{}), integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+			return integ.RateLimitedError(fmt.Errorf("slow down"), 3*time.Second)
+		})).
+		HttpStream(integ.NonIncremental("orders", struct{}{}), integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+			return integ.AuthError(fmt.Errorf("invalid key"))
+		}))
+
+	// retryable only if all streams fail with retryable errors
+	limited := integ.NewSource(config{}).
+		HttpStream(integ.NonIncremental("users", struct{}{}), integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+			return integ.TransientError(fmt.Errorf("unavailable"))
+		})).
+		HttpStream(integ.NonIncremental("orders", struct{}{}), integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+			return integ.RateLimitedError(fmt.Errorf("slow down"), 3*time.Second)
+		}))
+
+	srv := httptest.NewServer(integ.Handler(integ.Loaders{"src": src, "failing": failing, "limited": limited}, integ.Protos{"": airbyte.Airbyte}))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		path, config string
+		status       int
+		retryAfter   string
+	}{
+		{"/src/read", `{"key":1}`, http.StatusBadRequest, ""},
+		{"/failing/read", `{"key":"x"}`, http.StatusUnauthorized, ""},
+		{"/limited/read", `{"key":"x"}`, http.StatusTooManyRequests, "3"},
+	} {
+		resp, err := http.Post(srv.URL+c.path, "application/json", strings.NewReader(`{"type":"CONFIG","config":`+c.config+`}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Errorf("%s: expected %d, got %d", c.path, c.status, resp.StatusCode)
+		} else if got := resp.Header.Get("Retry-After"); got != c.retryAfter {
+			t.Errorf("%s: expected Retry-After %q, got %q", c.path, c.retryAfter, got)
+		}
+	}
+
+	// the runner errors are returned from Handle, the auth error decides the category
+	var w bytes.Buffer
+	err := failing.Handle(context.Background(), integ.CmdRead, &w, strings.NewReader(`{"type":"CONFIG","config":{"key":"x"}}`), integ.Protos{"": airbyte.Airbyte})
+	if err == nil || err.Error() != "stream users: slow down; stream orders: invalid key" {
+		t.Errorf("unexpected error %v", err)
+	} else if integ.Category(err) != integ.CategoryAuth || integ.RetryAfter(err) != 0 {
+		t.Errorf("expected a non retryable auth error, got %s", integ.Category(err))
+	}
+}
@@ -1,6 +1,10 @@
 package integ
 
 import (
+	"database/sql"
+	"io/fs"
+	"time"
+
 	"github.com/ajzo90/go-requests"
 	"github.com/valyala/fastjson"
 )
@@ -32,16 +36,33 @@ type GeneralContext interface {
 
 	Schema() Schema
 
+	// Configured returns the sync configuration selected for the stream
+	Configured() ConfiguredStream
+
 	// EmitState emit the state
 	EmitState(v interface{}) error
 
 	EmitLog(v any) error
 
+	// EmitEstimate reports the estimated number of records and bytes of the stream, 0 if unknown.
+	// Ignored by formats without estimates
+	EmitEstimate(rows, bytes int64) error
+
 	EmitValues(v []*fastjson.Value) error
 
 	EmitValue(v any) error
 
-	//EmitRelated(typ Schema, v any) error
+	// EmitRelated emits the record(s) v to the related stream typ, declared with SchemaBuilder.Related.
+	// The records are dropped if the related stream is not selected. Safe for concurrent use
+	EmitRelated(typ Schema, v any) error
+
+	// Related returns the context of the related stream typ, to load and emit its state.
+	// Returns ErrSkipStream if the stream is not selected. Safe for concurrent use
+	Related(typ Schema) (GeneralContext, error)
+
+	// FanOut calls fn(i) for i in [0, n), with at most concurrency calls running at the same time.
+	// Typically one child request per parent record. The first error is returned
+	FanOut(n, concurrency int, fn func(i int) error) error
 }
 
 type HttpContext interface {
@@ -52,12 +73,32 @@ type HttpContext interface {
 	// resp: (pre-allocated and reusable)
 	// path: (path to the data array)
 	EmitBatch(req *requests.Request, resp *requests.JSONResponse, keys ...string) error
+
+	// SetCursor registers the current state, it is emitted at the next checkpoint
+	SetCursor(v interface{})
+
+	// CheckpointEvery sets the checkpoint policy, the registered cursor is emitted
+	// every n records or every interval. Zero disables the condition.
+	CheckpointEvery(records int, interval time.Duration)
 }
 
 type DbContext interface {
 	GeneralContext
+
+	// EmitTable selects the schema fields from the table and emit the rows in chunks, using keyset
+	// pagination on the primary key. Incremental streams are ordered by the cursor (OrderByKey),
+	// continue after the state and emit the state after each chunk.
+	EmitTable(db *sql.DB, table DbTable) error
 }
 
 type FsContext interface {
 	GeneralContext
+
+	// EmitFiles parses the files in fsys matching the glob patterns and emit the records.
+	// The parser is selected by the file extension (json, jsonl, ndjson, xml and csv by default).
+	// Incremental streams emit files modified after the state, and emit the state after each file.
+	EmitFiles(fsys fs.FS, patterns ...string) error
+
+	// SetParser sets the parser used for files with the extension ext (".json")
+	SetParser(ext string, p requests.JSONParser)
 }
@@ -0,0 +1,141 @@
+package integ
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ajzo90/go-integ/pkg/csv"
+	"github.com/ajzo90/go-integ/pkg/jsonl"
+	"github.com/ajzo90/go-integ/pkg/xml"
+	"github.com/ajzo90/go-requests"
+	"github.com/valyala/fastjson"
+)
+
+// FilesConfig is the config used by FileRunner
+type FilesConfig struct {
+	Root     string   `json:"root"`
+	Patterns []string `json:"patterns"`
+}
+
+// FileRunner emits the files in the directory Root matching Patterns (see FilesConfig)
+var FileRunner = FsRunnerFunc(func(ctx FsContext) error {
+	var config FilesConfig
+	if err := ctx.Load(&config, nil); err != nil {
+		return err
+	}
+	return ctx.EmitFiles(os.DirFS(config.Root), config.Patterns...)
+})
+
+// FileState is the state of incremental file streams, files modified after the state are emitted
+type FileState struct {
+	ModTime time.Time `json:"mod_time"`
+	Name    string    `json:"name"`
+}
+
+func (s FileState) before(f FileState) bool {
+	return s.ModTime.Before(f.ModTime) || (s.ModTime.Equal(f.ModTime) && s.Name < f.Name)
+}
+
+type fsRunContext struct {
+	baseRunContext
+	parsers map[string]requests.JSONParser
+}
+
+func newFsRunCtx(ctx context.Context, schema Schema, sp StreamProto) *fsRunContext {
+	return &fsRunContext{baseRunContext: makeBaseRunCtx(ctx, schema, sp), parsers: map[string]requests.JSONParser{
+		".json":   &fastjson.Parser{},
+		".jsonl":  jsonl.NewParser(),
+		".ndjson": jsonl.NewParser(),
+		".xml":    xml.Decoder("", nil, false),
+		".csv":    csv.NewParser(),
+	}}
+}
+
+func (r *fsRunContext) SetParser(ext string, p requests.JSONParser) {
+	r.parsers[strings.ToLower(ext)] = p
+}
+
+func (r *fsRunContext) EmitFiles(fsys fs.FS, patterns ...string) error {
+	var state FileState
+	if r.schema.Incremental {
+		if err := r.Load(nil, &state); err != nil {
+			return err
+		}
+	}
+
+	files, err := globFiles(fsys, patterns)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if r.schema.Incremental && !state.before(f) {
+			continue
+		} else if err := r.emitFile(fsys, f.Name); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		} else if !r.schema.Incremental {
+			continue
+		} else if err := r.EmitState(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *fsRunContext) emitFile(fsys fs.FS, name string) error {
+	p, ok := r.parsers[strings.ToLower(path.Ext(name))]
+	if !ok {
+		return fmt.Errorf("no parser for extension '%s'", path.Ext(name))
+	}
+
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	v, err := p.ParseBytes(b)
+	if err != nil {
+		return err
+	} else if v == nil {
+		return nil
+	} else if v.Type() == fastjson.TypeArray {
+		return r.EmitValues(v.GetArray())
+	}
+	return r.EmitValues([]*fastjson.Value{v})
+}
+
+// globFiles returns the files matching the patterns, ordered by modification time and name
+func globFiles(fsys fs.FS, patterns []string) ([]FileState, error) {
+	var seen = map[string]bool{}
+	var files []FileState
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range matches {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			info, err := fs.Stat(fsys, name)
+			if err != nil {
+				return nil, err
+			} else if info.IsDir() {
+				continue
+			}
+			files = append(files, FileState{ModTime: info.ModTime().UTC(), Name: name})
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].before(files[j])
+	})
+	return files, nil
+}
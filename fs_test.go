@@ -0,0 +1,57 @@
+package integ_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ajzo90/go-integ"
+	"github.com/ajzo90/go-integ/pkg/airbyte"
+)
+
+// handle runs the command with the protocol messages in input, and returns the airbyte output
+func handle(t *testing.T, src integ.Loader, cmd integ.Command, input ...string) string {
+	t.Helper()
+	var w bytes.Buffer
+	if err := src.Handle(context.Background(), cmd, &w, strings.NewReader(strings.Join(input, "\n")), integ.Protos{"": airbyte.Airbyte}); err != nil {
+		t.Fatal(err)
+	}
+	return w.String()
+}
+
+func TestFsStream(t *testing.T) {
+	t0 := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"a.json":  {Data: []byte(`[{"id":"1"},{"id":"2"}]`), ModTime: t0},
+		"b.jsonl": {Data: []byte(`{"id":"3"}` + "\n" + `{"id":"4"}`), ModTime: t0.Add(time.Hour)},
+		"c.csv":   {Data: []byte("id,name\n5,x\n"), ModTime: t0.Add(2 * time.Hour)},
+		"d.xml":   {Data: []byte(`<id>6</id>`), ModTime: t0.Add(3 * time.Hour)},
+		"e.txt":   {Data: []byte(`ignored`), ModTime: t0},
+	}
+
+	src := integ.NewSource(struct{}{}).
+		FsStream(integ.Incremental("files", struct {
+			Id string `json:"id"`
+		}{}), integ.FsRunnerFunc(func(ctx integ.FsContext) error {
+			return ctx.EmitFiles(fsys, "*.json", "*.jsonl", "*.csv", "*.xml")
+		}))
+
+	out := handle(t, src, integ.CmdRead, `{"type":"CONFIG","config":{}}`)
+	for _, id := range []string{"1", "2", "3", "4", "5", "6"} {
+		if !strings.Contains(out, `"id":"`+id+`"`) {
+			t.Errorf("expected record %s: %s", id, out)
+		}
+	}
+	if !strings.Contains(out, `"stream_state":{"mod_time":"2022-01-01T03:00:00Z","name":"d.xml"}`) {
+		t.Errorf("expected state after d.xml: %s", out)
+	}
+
+	out = handle(t, src, integ.CmdRead, `{"type":"CONFIG","config":{}}`,
+		`{"type":"STATE","stream":"files","state":{"mod_time":"2022-01-01T01:00:00Z","name":"b.jsonl"}}`)
+	if strings.Contains(out, `"id":"3"`) || !strings.Contains(out, `"id":"5"`) {
+		t.Errorf("expected files after b.jsonl: %s", out)
+	}
+}
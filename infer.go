@@ -0,0 +1,344 @@
+package integ
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ajzo90/go-jsonschema-generator"
+	"github.com/valyala/fastjson"
+)
+
+// InferredSchema is the schema inferred from the sampled records of a stream
+type InferredSchema struct {
+	Stream  string
+	Records int
+	Schema  *jsonschema.Document
+	// GoStruct is a go type declaration matching the schema, with json tags
+	GoStruct string
+	// Err is the error returned by the runner, if any
+	Err error
+}
+
+var errSampleLimit = fmt.Errorf("sample limit reached")
+
+// InferSchemas runs the streams in sampling mode and infers the schemas from the first limit records of
+// each stream, all records are sampled if limit <= 0. rd provides the input messages (config and state).
+// All streams are sampled if none are provided
+func (r *sourceDef) InferSchemas(ctx context.Context, rd io.Reader, limit int, streams ...string) ([]InferredSchema, error) {
+	i, err := parseProtocol(rd, io.Discard, CmdRead)
+	if err != nil {
+		return nil, err
+	}
+	proto := &samplingProto{Protocol: i, limit: limit}
+
+	selected := func(name string) bool {
+		return len(streams) == 0 || contains(streams, name)
+	}
+
+	for _, runner := range r.runners {
+		if !selected(runner.schema.Name) {
+			continue
+		}
+		// the raw records are sampled
+		runner.schema.Validation, runner.schema.CoerceTypes, runner.schema.DriftDetection = ValidateNone, false, false
+		// a failing stream is reported with the records sampled so far
+		runner.noRecover = r.noRecover
+		if err := run(ctx, proto, runner, true); err != nil && !errors.As(err, new(*streamFailure)) {
+			return nil, err
+		}
+	}
+	if r.manualRunner != nil {
+		proto.filter = selected
+		if err := r.runManual(&manualCtx{ctx: ctx, p: proto}); err != nil && !errors.Is(err, errSampleLimit) {
+			return nil, err
+		}
+	}
+
+	var out []InferredSchema
+	for _, s := range proto.streams {
+		doc, err := s.root.document()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, InferredSchema{
+			Stream:   s.schema.Name,
+			Records:  s.records,
+			Schema:   doc,
+			GoStruct: s.root.goStruct(goName(s.schema.Name)),
+			Err:      s.err,
+		})
+	}
+	return out, nil
+}
+
+// samplingProto collects the records of the opened streams until the limit is reached
+type samplingProto struct {
+	*Protocol
+	limit   int
+	filter  func(name string) bool
+	streams []*samplingStream
+}
+
+func (p *samplingProto) Open(schema Schema) (StreamProto, error) {
+	if p.filter != nil && !p.filter(schema.Name) {
+		return nil, nil
+	}
+	s := &samplingStream{p: p.Protocol, schema: schema, limit: p.limit, root: &inferNode{}}
+	p.streams = append(p.streams, s)
+	return s, nil
+}
+
+func (p *samplingProto) Close() error {
+	return nil
+}
+
+func (p *samplingProto) EmitSpec(ConnectorSpecification) error {
+	return nil
+}
+
+func (p *samplingProto) EmitStatus(error) error {
+	return nil
+}
+
+type samplingStream struct {
+	p       *Protocol
+	schema  Schema
+	limit   int
+	records int
+	root    *inferNode
+	err     error
+}
+
+func (s *samplingStream) Load(config, state interface{}) error {
+	return s.p.LoadStream(StreamKey{Namespace: s.schema.Namespace, Name: s.schema.Name}, config, state)
+}
+
+// EmitValues observes the records, errSampleLimit stops the runner when the limit is reached
+func (s *samplingStream) EmitValues(values []*fastjson.Value) error {
+	for _, v := range values {
+		if s.limitReached() {
+			break
+		}
+		s.root.observe(v)
+		s.records++
+	}
+	if s.limitReached() {
+		return errSampleLimit
+	}
+	return nil
+}
+
+func (s *samplingStream) limitReached() bool {
+	return s.limit > 0 && s.records >= s.limit
+}
+
+func (s *samplingStream) EmitState(interface{}) error {
+	return nil
+}
+
+// EmitLog records the error of the stream, run reports the runner errors as logs
+func (s *samplingStream) EmitLog(v interface{}) error {
+	if err, ok := v.(error); ok && !errors.Is(err, errSampleLimit) {
+		s.err = err
+	}
+	return nil
+}
+
+func (s *samplingStream) Configured() ConfiguredStream {
+	return s.schema.Configured()
+}
+
+func (s *samplingStream) Flush() error {
+	return nil
+}
+
+// inferNode merges the values observed at a path of the records
+type inferNode struct {
+	count       int
+	objects     int
+	types       map[string]bool
+	notDateTime bool
+	props       map[string]*inferNode
+	keys        []string // in order of appearance
+	items       *inferNode
+}
+
+func (n *inferNode) observe(v *fastjson.Value) {
+	if n.types == nil {
+		n.types = map[string]bool{}
+	}
+	n.count++
+	n.types[jsonType(v)] = true
+
+	switch v.Type() {
+	case fastjson.TypeString:
+		if _, err := time.Parse(time.RFC3339Nano, string(v.GetStringBytes())); err != nil {
+			n.notDateTime = true
+		}
+	case fastjson.TypeObject:
+		n.objects++
+		if n.props == nil {
+			n.props = map[string]*inferNode{}
+		}
+		v.GetObject().Visit(func(key []byte, child *fastjson.Value) {
+			prop := n.props[string(key)]
+			if prop == nil {
+				prop = &inferNode{}
+				n.props[string(key)] = prop
+				n.keys = append(n.keys, string(key))
+			}
+			prop.observe(child)
+		})
+	case fastjson.TypeArray:
+		for _, item := range v.GetArray() {
+			if n.items == nil {
+				n.items = &inferNode{}
+			}
+			n.items.observe(item)
+		}
+	}
+}
+
+var inferTypes = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// typeList returns the observed types, integers are merged into numbers when both are observed
+func (n *inferNode) typeList() []string {
+	var out []string
+	for _, t := range inferTypes {
+		if n.types[t] && !(t == "integer" && n.types["number"]) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func (n *inferNode) schema() *jsonSchema {
+	s := &jsonSchema{Type: n.typeList()}
+	if n.types["string"] && !n.notDateTime {
+		s.Format = "date-time"
+	}
+	if n.props != nil {
+		s.Properties = map[string]*jsonSchema{}
+		for _, k := range n.keys {
+			prop := n.props[k]
+			s.Properties[k] = prop.schema()
+			if prop.count == n.objects {
+				s.Required = append(s.Required, k)
+			}
+		}
+	}
+	if n.items != nil {
+		s.Items = n.items.schema()
+	}
+	return s
+}
+
+func (n *inferNode) document() (*jsonschema.Document, error) {
+	b, err := json.Marshal(n.schema())
+	if err != nil {
+		return nil, err
+	}
+	doc := &jsonschema.Document{Schema: jsonschema.DEFAULT_SCHEMA}
+	return doc, json.Unmarshal(b, doc)
+}
+
+// goStruct returns a type declaration of the records, properties not present in all records are omitempty
+func (n *inferNode) goStruct(name string) string {
+	var b strings.Builder
+	b.WriteString("type " + name + " ")
+	n.writeGoType(&b)
+	src, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return b.String()
+	}
+	return string(src)
+}
+
+func (n *inferNode) writeGoType(b *strings.Builder) {
+	var types []string
+	for _, t := range n.typeList() {
+		if t != "null" {
+			types = append(types, t)
+		}
+	}
+	if len(types) != 1 {
+		b.WriteString("interface{}")
+		return
+	} else if n.types["null"] && types[0] != "object" && types[0] != "array" {
+		b.WriteString("*")
+	}
+
+	switch types[0] {
+	case "object":
+		if len(n.keys) == 0 {
+			b.WriteString("map[string]interface{}")
+			return
+		}
+		b.WriteString("struct {\n")
+		var names = map[string]int{}
+		for _, k := range n.keys {
+			prop := n.props[k]
+			name := goName(k)
+			if names[name]++; names[name] > 1 {
+				name += strconv.Itoa(names[name])
+			}
+			b.WriteString(name + " ")
+			prop.writeGoType(b)
+			tag := k
+			if prop.count < n.objects {
+				tag += ",omitempty"
+			}
+			b.WriteString(" `json:\"" + tag + "\"`\n")
+		}
+		b.WriteString("}")
+	case "array":
+		b.WriteString("[]")
+		if n.items == nil {
+			b.WriteString("interface{}")
+		} else {
+			n.items.writeGoType(b)
+		}
+	case "string":
+		if n.notDateTime {
+			b.WriteString("string")
+		} else {
+			b.WriteString("time.Time")
+		}
+	case "integer":
+		b.WriteString("int64")
+	case "number":
+		b.WriteString("float64")
+	case "boolean":
+		b.WriteString("bool")
+	}
+}
+
+// goName converts a json key to an exported go identifier, "created_at" -> "CreatedAt"
+func goName(key string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		} else if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteString("X")
+		}
+		if upper {
+			r, upper = unicode.ToUpper(r), false
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "X"
+	}
+	return b.String()
+}
@@ -0,0 +1,68 @@
+package integ_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ajzo90/go-integ"
+	"github.com/valyala/fastjson"
+)
+
+func TestInferSchemas(t *testing.T) {
+	src := integ.NewSource(struct{}{}).
+		GeneralStream(integ.NonIncremental("line_items", struct{}{}), integ.GeneralRunnerFunc(func(ctx integ.GeneralContext) error {
+			for {
+				err := ctx.EmitValues(fastjson.MustParse(`[
+					{"id":1,"price":"10.5","created_at":"2022-04-07T12:39:06+02:00","tags":["a"],"discount":null},
+					{"id":2,"price":"8","created_at":"2022-04-08T12:39:06+02:00","tags":[],"discount":1.5,"note":"x"}
+				]`).GetArray())
+				if err != nil {
+					return err
+				}
+			}
+		}))
+
+	schemas, err := src.InferSchemas(context.Background(), strings.NewReader(""), 3)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(schemas) != 1 || schemas[0].Records != 3 || schemas[0].Err != nil {
+		t.Fatalf("unexpected result %+v", schemas)
+	}
+
+	const doc = `{"$schema":"http://json-schema.org/schema#","type":["object"],"properties":{"created_at":{"type":["string"],"format":"date-time"},"discount":{"type":["number","null"]},"id":{"type":["integer"]},"note":{"type":["string"]},"price":{"type":["string"]},"tags":{"type":["array"],"items":{"type":["string"]}}},"required":["id","price","created_at","tags","discount"]}`
+	if s := schemas[0].Schema.Marshal(); s != doc {
+		t.Errorf("unexpected schema %s", s)
+	}
+
+	const goStruct = "type LineItems struct {\n" +
+		"\tId        int64     `json:\"id\"`\n" +
+		"\tPrice     string    `json:\"price\"`\n" +
+		"\tCreatedAt time.Time `json:\"created_at\"`\n" +
+		"\tTags      []string  `json:\"tags\"`\n" +
+		"\tDiscount  *float64  `json:\"discount\"`\n" +
+		"\tNote      string    `json:\"note,omitempty\"`\n" +
+		"}"
+	if schemas[0].GoStruct != goStruct {
+		t.Errorf("unexpected go struct\n%s", schemas[0].GoStruct)
+	}
+}
+
+func TestInferSchemasWithoutLimit(t *testing.T) {
+	src := integ.NewSource(struct{}{}).
+		GeneralStream(integ.NonIncremental("users", struct{}{}), integ.GeneralRunnerFunc(func(ctx integ.GeneralContext) error {
+			for i := 0; i < 5; i++ {
+				if err := ctx.EmitValue(map[string]int{"id": i}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+
+	schemas, err := src.InferSchemas(context.Background(), strings.NewReader(""), 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(schemas) != 1 || schemas[0].Records != 5 || schemas[0].Err != nil {
+		t.Fatalf("expected all records to be sampled, got %+v", schemas)
+	}
+}
@@ -1,11 +1,13 @@
 package shopify
 
 import (
+	"encoding/json"
 	"strings"
 	"time"
 
 	"github.com/ajzo90/go-integ"
 	"github.com/ajzo90/go-requests"
+	"github.com/valyala/fastjson"
 )
 
 var Source = integ.NewSource(config{}).
@@ -17,7 +19,7 @@ var Source = integ.NewSource(config{}).
 
 type config struct {
 	ApiKey integ.MaskedString `json:"api_key"`
-	Url    string             `json:"url" default:"x" hint:"https://xxx.myshopify.com/admin/api/2021-10/"`
+	Url    string             `json:"url" hint:"https://xxx.myshopify.com/admin/api/2021-10/"`
 }
 
 func (config *config) request() *requests.Request {
@@ -35,35 +37,67 @@ type runner struct {
 	path string
 }
 
+type state struct {
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// stateDef is version 1 of the state, version 0 was {"To": time}
+var stateDef = integ.NewState[state](1).
+	Migrate(0, func(old json.RawMessage) (json.RawMessage, error) {
+		var v0 struct {
+			To time.Time
+		}
+		if err := json.Unmarshal(old, &v0); err != nil {
+			return nil, err
+		}
+		return json.Marshal(state{UpdatedAt: v0.To})
+	})
+
 func (s *runner) Run(ctx integ.HttpContext) error {
-	var state struct {
-		To time.Time
-	}
 	var config config
-	if err := ctx.Load(&config, &state); err != nil {
+	state, err := stateDef.Load(ctx, &config)
+	if err != nil {
 		return err
 	}
-	from, to := timeWindow(state.To)
+	from, to := timeWindow(state.UpdatedAt)
 
 	req := config.request().
 		Path(s.path+".json").
 		Query("updated_at_min", from.Format(time.RFC3339)).
 		Query("updated_at_max", to.Format(time.RFC3339)).
 		Query("fields", strings.Join(ctx.Schema().FieldKeys(), ",")).
+		Query("order", "updated_at asc").
 		Query("status", "any")
 
+	// a killed job resumes from the last checkpointed page
+	ctx.CheckpointEvery(10000, time.Minute)
+
 	for resp := new(requests.JSONResponse); ; {
 		if err := ctx.EmitBatch(req, resp, s.path); err != nil {
 			return err
-		} else if next := ParseNext(resp.Header("link")); next == "" {
-			state.To = to
-			return ctx.EmitState(state)
+		} else if last := lastUpdated(resp.GetArray(s.path)); !last.IsZero() {
+			state.UpdatedAt = last
+			stateDef.SetCursor(ctx, state)
+		}
+
+		if next := ParseNext(resp.Header("link")); next == "" {
+			state.UpdatedAt = to
+			return stateDef.Emit(ctx, state)
 		} else {
 			req = config.request().Url(next)
 		}
 	}
 }
 
+// lastUpdated returns updated_at of the last record, records are ordered by updated_at
+func lastUpdated(arr []*fastjson.Value) time.Time {
+	if len(arr) == 0 {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339, string(arr[len(arr)-1].GetStringBytes("updated_at")))
+	return t
+}
+
 func timeWindow(old time.Time) (from, to time.Time) {
 	if old.IsZero() {
 		old = time.Now().Add(-time.Hour * 24 * 365 * 10) // 10 years
@@ -6,6 +6,8 @@ import (
 
 var id = integ.Field("id")
 
+var updatedAt = integ.Field("updated_at")
+
 var users = integ.Incremental("users", struct {
 	Id               int    `json:"id"`
 	Email            string `json:"email"`
@@ -13,10 +15,10 @@ var users = integ.Incremental("users", struct {
 	UpdatedAt        string `json:"updated_at"`
 	VerifiedEmail    bool   `json:"verified_email"`
 	AcceptsMarketing bool   `json:"accepts_marketing"`
-}{}).Primary(id)
+}{}).Primary(id).OrderBy(updatedAt)
 
 var orders = integ.Incremental("orders", struct {
 	Id        string  `json:"id"`
 	Price     float64 `json:"price"`
 	UpdatedAt string  `json:"updated_at"`
-}{}).Primary(id)
+}{}).Primary(id).OrderBy(updatedAt)
@@ -32,13 +32,13 @@ type config struct {
 	SiteId    string
 	ApiId     string
 	Password  string
-	Num       int
+	Num       int `default:"10"`
 }
 
 // todo: implement incremental sync
 
 var Runner = integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
-	cnf := config{Num: 10}
+	var cnf config
 	if err := ctx.Load(&cnf, nil); err != nil {
 		return err
 	}
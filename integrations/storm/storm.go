@@ -12,6 +12,7 @@ var Loader = integ.NewSource(config{}).
 	HttpStream(orders, Runner("Orders/Orders")).
 	HttpStream(customers, Runner("Customers/Customers")).
 	HttpStream(items, Runner("Products/ProductSkus")).
+	Concurrency(3).
 	Documentation(
 		"https://storm.io/docs/storm-api/",
 		"https://stormdocs.atlassian.net/servicedesk/customer/portal/1/article/2215706817",
@@ -44,14 +45,10 @@ func (s *runner) Run(ctx integ.HttpContext) error {
 
 	schema := ctx.Schema()
 
-	req := newReq().Path(s.path).Query("$select", strings.Join(schema.FieldKeys(), ","))
-
-	for name, p := range schema.JsonSchema.Properties {
-		for _, typ := range p.Type {
-			if typ == "object" {
-				req.Query("$expand", fmt.Sprintf("%s($select=%s)", name, strings.Join(p.Required, ",")))
-			}
-		}
+	sel, expand := selectFields(schema.FieldPaths())
+	req := newReq().Path(s.path).Query("$select", sel)
+	if expand != "" {
+		req.Query("$expand", expand)
 	}
 
 	for resp := new(requests.JSONResponse); ; {
@@ -64,3 +61,40 @@ func (s *runner) Run(ctx integ.HttpContext) error {
 		}
 	}
 }
+
+// selectFields builds the $select and $expand options of the field paths, nested fields are
+// selected in the expanded entity: Product($select=Id,Name;$expand=Manufacturer($select=Id))
+func selectFields(paths [][]string) (string, string) {
+	var sel, names []string
+	var nested = map[string][][]string{}
+	for _, p := range paths {
+		if !contains(sel, p[0]) {
+			sel = append(sel, p[0])
+		}
+		if len(p) > 1 {
+			if _, ok := nested[p[0]]; !ok {
+				names = append(names, p[0])
+			}
+			nested[p[0]] = append(nested[p[0]], p[1:])
+		}
+	}
+
+	var expand []string
+	for _, name := range names {
+		s, e := selectFields(nested[name])
+		if e != "" {
+			s += ";$expand=" + e
+		}
+		expand = append(expand, fmt.Sprintf("%s($select=%s)", name, s))
+	}
+	return strings.Join(sel, ","), strings.Join(expand, ",")
+}
+
+func contains(arr []string, s string) bool {
+	for _, v := range arr {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
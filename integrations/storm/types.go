@@ -8,21 +8,21 @@ var orders = integ.NonIncremental("orders", struct {
 	Id        int32
 	OrderNo   float64
 	OrderDate string
-}{}).Primary(integ.Field("Id"))
+}{}).Primary(integ.Field("Id")).Coerce()
 
 var customers = integ.NonIncremental("users", struct {
 	Id           int32
 	Key          string
 	EmailAddress string
 	IsActive     bool
-}{}).Primary(integ.Field("Id"))
+}{}).Primary(integ.Field("Id")).Coerce()
 
 var items = integ.NonIncremental("items", struct {
 	StatusId  int
 	PartNo    string
 	IsBuyable bool
 	Product   Product
-}{})
+}{}).Primary(integ.Field("PartNo"), integ.Field("Product", "Id")).Coerce()
 
 type Product struct {
 	Id                 int
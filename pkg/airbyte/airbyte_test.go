@@ -0,0 +1,274 @@
+package airbyte
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ajzo90/go-integ"
+)
+
+type testConfig struct {
+	Url string `json:"url"`
+}
+
+func emitName(ctx integ.HttpContext) error {
+	if err := ctx.Load(&testConfig{}, nil); err != nil {
+		return err
+	}
+	return ctx.EmitValue(map[string]string{"name": ctx.Schema().Name, "mode": string(ctx.Configured().SyncMode)})
+}
+
+func testSource() integ.Loader {
+	type rec struct {
+		Name string `json:"name"`
+		Mode string `json:"mode"`
+	}
+	return integ.NewSource(testConfig{}).
+		HttpStream(integ.Incremental("users", rec{}).CustomOrderBy().Primary(integ.Field("name")), integ.HttpRunnerFunc(emitName)).
+		HttpStream(integ.Incremental("orders", rec{}).CustomOrderBy(), integ.HttpRunnerFunc(emitName))
+}
+
+func TestReadCatalog(t *testing.T) {
+	const catalog = `{"streams":[{"stream":{"name":"orders"},"sync_mode":"full_refresh","destination_sync_mode":"overwrite"}]}`
+
+	var w bytes.Buffer
+	if err := cmd([]string{"x", "read", "--config", `{"url":"x"}`, "--catalog", catalog}, testSource(), &w); err != nil {
+		t.Fatal(err)
+	}
+
+	out := w.String()
+	if strings.Contains(out, `"name":"users"`) {
+		t.Errorf("unselected stream emitted: %s", out)
+	} else if !strings.Contains(out, `"data":{"mode":"full_refresh","name":"orders"}`) {
+		t.Errorf("expected orders in full_refresh mode: %s", out)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	var w bytes.Buffer
+	if err := cmd([]string{"x", "discover", "--config", `{"url":"x"}`}, testSource(), &w); err != nil {
+		t.Fatal(err)
+	}
+
+	out := w.String()
+	if n := strings.Count(out, `"type":"CATALOG"`); n != 1 {
+		t.Errorf("expected one catalog, got %d: %s", n, out)
+	} else if !strings.Contains(out, `"name":"users","json_schema":`) {
+		t.Errorf("expected users stream: %s", out)
+	} else if !strings.Contains(out, `"supported_sync_modes":["full_refresh","incremental"],"source_defined_primary_key":[["name"]]`) {
+		t.Errorf("expected sync modes and primary key: %s", out)
+	} else if strings.Contains(out, "GoType") {
+		t.Errorf("unexpected go specific fields: %s", out)
+	}
+}
+
+func TestState(t *testing.T) {
+	type state struct {
+		N int `json:"n"`
+	}
+	src := integ.NewSource(testConfig{}).
+		HttpStream(integ.Incremental("users", state{}).CustomOrderBy(), integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+			var st state
+			if err := ctx.Load(&testConfig{}, &st); err != nil {
+				return err
+			}
+			st.N++
+			return ctx.EmitState(st)
+		}))
+
+	for _, c := range []struct{ state, expected string }{
+		{`{"users":{"n":1}}`, `{"type":"STREAM","stream":{"stream_descriptor":{"name":"users"},"stream_state":{"n":2}}}`},
+		{`[{"type":"STREAM","stream":{"stream_descriptor":{"name":"users"},"stream_state":{"n":2}}}]`, `"stream_state":{"n":3}`},
+		{`{"type":"GLOBAL","global":{"shared_state":{"x":1},"stream_states":[{"stream_descriptor":{"name":"users"},"stream_state":{"n":3}}]}}`, `{"type":"GLOBAL","global":{"shared_state":{"x":1},"stream_states":[{"stream_descriptor":{"name":"users"},"stream_state":{"n":4}}]}}`},
+	} {
+		var w bytes.Buffer
+		if err := cmd([]string{"x", "read", "--config", `{"url":"x"}`, "--state", c.state}, src, &w); err != nil {
+			t.Fatal(err)
+		} else if !strings.Contains(w.String(), c.expected) {
+			t.Errorf("expected %s, got %s", c.expected, w.String())
+		}
+	}
+}
+
+func TestStateNamespaces(t *testing.T) {
+	type state struct {
+		N int `json:"n"`
+	}
+	run := integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+		var st state
+		if err := ctx.Load(&testConfig{}, &st); err != nil {
+			return err
+		}
+		st.N++
+		return ctx.EmitState(st)
+	})
+	src := integ.NewSource(testConfig{}).
+		HttpStream(integ.Incremental("users", state{}).CustomOrderBy().Namespace("a"), run).
+		HttpStream(integ.Incremental("users", state{}).CustomOrderBy().Namespace("b"), run)
+
+	const states = `[{"type":"STREAM","stream":{"stream_descriptor":{"name":"users","namespace":"a"},"stream_state":{"n":1}}},` +
+		`{"type":"STREAM","stream":{"stream_descriptor":{"name":"users","namespace":"b"},"stream_state":{"n":5}}}]`
+	var w bytes.Buffer
+	if err := cmd([]string{"x", "read", "--config", `{"url":"x"}`, "--state", states}, src, &w); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`"stream_descriptor":{"name":"users","namespace":"a"},"stream_state":{"n":2}`,
+		`"stream_descriptor":{"name":"users","namespace":"b"},"stream_state":{"n":6}`,
+	} {
+		if !strings.Contains(w.String(), expected) {
+			t.Errorf("expected %s, got %s", expected, w.String())
+		}
+	}
+}
+
+// a legacy state of a stream named bookmarks is not a singer state
+func TestLegacyStateBookmarks(t *testing.T) {
+	type state struct {
+		N int `json:"n"`
+	}
+	src := integ.NewSource(testConfig{}).
+		HttpStream(integ.Incremental("bookmarks", state{}).CustomOrderBy(), integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+			var st state
+			if err := ctx.Load(&testConfig{}, &st); err != nil {
+				return err
+			}
+			st.N++
+			return ctx.EmitState(st)
+		}))
+
+	var w bytes.Buffer
+	if err := cmd([]string{"x", "read", "--config", `{"url":"x"}`, "--state", `{"bookmarks":{"n":1}}`}, src, &w); err != nil {
+		t.Fatal(err)
+	} else if expected := `"stream_descriptor":{"name":"bookmarks"},"stream_state":{"n":2}`; !strings.Contains(w.String(), expected) {
+		t.Errorf("expected %s, got %s", expected, w.String())
+	}
+}
+
+func TestInvalidArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"--config", `1`},
+		{"--config", `"x"`},
+		{"--config", `[]`},
+		{"--config", `{"url":"x"}`, "--state", `1`},
+	} {
+		var w bytes.Buffer
+		if err := cmd(append([]string{"x", "read"}, args...), testSource(), &w); err == nil || !strings.Contains(err.Error(), "invalid json") {
+			t.Errorf("%v: expected invalid json, got %v", args, err)
+		}
+	}
+}
+
+func TestGlobalStateNotSelected(t *testing.T) {
+	type state struct {
+		N int `json:"n"`
+	}
+	run := integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+		var st state
+		if err := ctx.Load(&testConfig{}, &st); err != nil {
+			return err
+		}
+		st.N++
+		return ctx.EmitState(st)
+	})
+	src := integ.NewSource(testConfig{}).
+		HttpStream(integ.Incremental("users", state{}).CustomOrderBy(), run).
+		HttpStream(integ.Incremental("orders", state{}).CustomOrderBy(), run)
+
+	const (
+		globalState = `{"type":"GLOBAL","global":{"stream_states":[{"stream_descriptor":{"name":"users"},"stream_state":{"n":1}},{"stream_descriptor":{"name":"orders"},"stream_state":{"n":5}}]}}`
+		catalog     = `{"streams":[{"stream":{"name":"users"},"sync_mode":"incremental","destination_sync_mode":"append"}]}`
+		expected    = `"stream_states":[{"stream_descriptor":{"name":"orders"},"stream_state":{"n":5}},{"stream_descriptor":{"name":"users"},"stream_state":{"n":2}}]`
+	)
+
+	var w bytes.Buffer
+	if err := cmd([]string{"x", "read", "--config", `{"url":"x"}`, "--state", globalState, "--catalog", catalog}, src, &w); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(w.String(), expected) {
+		t.Errorf("expected the state of the unselected stream to be kept, %s, got %s", expected, w.String())
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	src := integ.NewSource(testConfig{}).
+		HttpStream(integ.Incremental("users", struct{}{}).CustomOrderBy(), integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+			ctx.CheckpointEvery(2, 0)
+			for i := 1; i <= 3; i++ {
+				if err := ctx.EmitValue(map[string]int{"i": i}); err != nil {
+					return err
+				}
+				ctx.SetCursor(map[string]int{"i": i})
+			}
+			return nil
+		}))
+
+	var w bytes.Buffer
+	if err := cmd([]string{"x", "read", "--config", `{"url":"x"}`}, src, &w); err != nil {
+		t.Fatal(err)
+	}
+
+	var states []string
+	for _, line := range strings.Split(strings.TrimSpace(w.String()), "\n") {
+		if strings.Contains(line, `"type":"STATE"`) {
+			states = append(states, line[strings.Index(line, `"stream_state"`):])
+		}
+	}
+	// checkpoint after the second record (with the cursor of the first) and when the stream completes
+	if len(states) != 2 || !strings.HasPrefix(states[0], `"stream_state":{"i":1}`) || !strings.HasPrefix(states[1], `"stream_state":{"i":3}`) {
+		t.Errorf("unexpected states %v", states)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	src := integ.NewSource(testConfig{}).
+		HttpStream(integ.NonIncremental("users", struct{}{}), integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+			if err := ctx.EmitEstimate(10, 0); err != nil {
+				return err
+			}
+			return ctx.EmitValue(map[string]int{"i": 1})
+		})).
+		HttpStream(integ.NonIncremental("orders", struct{}{}), integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+			return integ.ConfigError(fmt.Errorf("invalid api key"))
+		}))
+
+	// the config error of orders fails the sync, after users completes
+	var w bytes.Buffer
+	if err := cmd([]string{"x", "read", "--config", `{"url":"x"}`}, src, &w); integ.Category(err) != integ.CategoryConfig {
+		t.Fatalf("expected a config error, got %v", err)
+	}
+
+	var traces []string
+	for _, line := range strings.Split(strings.TrimSpace(w.String()), "\n") {
+		if strings.Contains(line, `"type":"TRACE"`) {
+			traces = append(traces, line)
+		}
+	}
+	for i, s := range []string{
+		`"stream_status":{"stream_descriptor":{"name":"users"},"status":"STARTED"}`,
+		`"estimate":{"name":"users","type":"STREAM","row_estimate":10}`,
+		`"stream_status":{"stream_descriptor":{"name":"users"},"status":"RUNNING"}`,
+		`"stream_status":{"stream_descriptor":{"name":"users"},"status":"COMPLETE"}`,
+		`"stream_status":{"stream_descriptor":{"name":"orders"},"status":"STARTED"}`,
+		`"error":{"message":"stream orders failed: invalid api key","internal_message":"invalid api key","failure_type":"config_error","stream_descriptor":{"name":"orders"}}`,
+		`"stream_status":{"stream_descriptor":{"name":"orders"},"status":"INCOMPLETE"}`,
+	} {
+		if len(traces) <= i || !strings.Contains(traces[i], s) {
+			t.Errorf("expected %s at %d in %v", s, i, traces)
+		}
+	}
+	// the failure is traced on the stream only
+	if len(traces) != 7 {
+		t.Errorf("expected 7 traces, got %d: %v", len(traces), traces)
+	}
+}
+
+func TestConfigErrorTrace(t *testing.T) {
+	var w bytes.Buffer
+	if err := cmd([]string{"x", "read", "--config", `{"url":1}`}, testSource(), &w); err == nil {
+		t.Fatal("expected error")
+	} else if !strings.Contains(w.String(), `"failure_type":"config_error"`) {
+		t.Errorf("expected config error trace: %s", w.String())
+	}
+}
@@ -44,7 +44,6 @@ func cmd(args []string, loader integ.Loader, w io.Writer) error {
 			continue
 		}
 
-		m := map[string]interface{}{}
 		b, err := os.ReadFile(args[i+1])
 		if errors.Is(err, fs.ErrNotExist) {
 			b = []byte(args[i+1])
@@ -52,25 +51,35 @@ func cmd(args []string, loader integ.Loader, w io.Writer) error {
 			return err
 		}
 
-		if err := json.Unmarshal(b, &m); err != nil {
-			return err
-		}
-
-		var typ, key string
+		var typ, key, expected = "", "", "{"
 		switch p {
 		case "--config":
 			typ, key = "CONFIG", "config"
 		case "--state":
-			typ, key = "STATE", "state"
+			// the state is an object (legacy) or a list of state messages
+			typ, key, expected = "STATE", "state", "{["
 		case "--catalog":
 			typ, key = "CATALOG", "catalog"
 		}
+
+		if b = bytes.TrimSpace(b); !json.Valid(b) || !strings.ContainsRune(expected, rune(b[0])) {
+			return fmt.Errorf("invalid json for %s, expected %s", p, strings.Join(strings.Split(expected, ""), " or "))
+		}
+		m := json.RawMessage(b)
+
 		if err := enc.Encode(map[string]any{"type": typ, key: m}); err != nil {
 			return err
 		}
 	}
 
-	return loader.Handle(context.Background(), cmd, w, bytes.NewReader(b.Bytes()), integ.Protos{
+	err := loader.Handle(context.Background(), cmd, w, bytes.NewReader(b.Bytes()), integ.Protos{
 		"airbyte": Airbyte,
 	})
+	if err != nil && !integ.Reported(err) {
+		// the platform classifies the failure from the trace, stream failures are traced on the stream
+		if err := json.NewEncoder(w).Encode(map[string]any{"type": integ.TRACE, "trace": newErrorTrace(nil, err)}); err != nil {
+			return err
+		}
+	}
+	return err
 }
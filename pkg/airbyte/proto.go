@@ -1,7 +1,9 @@
 package airbyte
 
 import (
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ajzo90/go-integ"
@@ -9,13 +11,54 @@ import (
 )
 
 var Airbyte integ.ProtoFn = func(p *integ.Protocol) integ.Proto {
-	return &proto{Protocol: p, regState: map[string]interface{}{}}
+	m := &proto{Protocol: p, regState: map[StreamDescriptor]interface{}{}}
+	// the loaded states are kept in the global checkpoints, including streams that are not selected or not yet run
+	for key, state := range p.States() {
+		m.regState[StreamDescriptor{Name: key.Name, Namespace: key.Namespace}] = state
+	}
+	m.catalog, m.catalogErr = loadCatalog(p)
+	return m
 }
 
 type proto struct {
 	*integ.Protocol
-	regState map[string]interface{}
-	schemas  []integ.Schema
+	stateMtx   sync.Mutex
+	regState   map[StreamDescriptor]interface{}
+	schemasMtx sync.Mutex
+	schemas    []integ.Schema
+	catalog    *ConfiguredCatalog
+	catalogErr error
+}
+
+func loadCatalog(p *integ.Protocol) (*ConfiguredCatalog, error) {
+	var catalog ConfiguredCatalog
+	if ok, err := p.Catalog(&catalog); err != nil || !ok {
+		return nil, err
+	}
+	return &catalog, nil
+}
+
+// configured returns the sync configuration of the stream, ok is false if the stream is not selected
+func (m *proto) configured(schema integ.Schema) (c integ.ConfiguredStream, ok bool) {
+	c = schema.Configured()
+	if m.catalog == nil {
+		return c, true
+	}
+	for _, s := range m.catalog.Streams {
+		if s.Stream.Name != schema.Name || s.Stream.Namespace != schema.Namespace {
+			continue
+		}
+		c.SyncMode = integ.SyncMode(s.SyncMode)
+		c.DestinationSyncMode = string(s.DestinationSyncMode)
+		if len(s.CursorField) > 0 {
+			c.CursorField = s.CursorField
+		}
+		if len(s.PrimaryKey) > 0 {
+			c.PrimaryKey = s.PrimaryKey
+		}
+		return c, true
+	}
+	return c, false
 }
 
 func newRecord(stream string) *fastjson.Value {
@@ -32,24 +75,85 @@ func newRecord(stream string) *fastjson.Value {
 }
 
 func (m *proto) Open(schema integ.Schema) (integ.StreamProto, error) {
-	regStateFn := func(v interface{}) {
-		m.regState[schema.Name] = v
+	if m.catalogErr != nil {
+		return nil, m.catalogErr
+	}
+	configured, ok := m.configured(schema)
+	if !ok {
+		return nil, nil
 	}
+	m.schemasMtx.Lock()
 	m.schemas = append(m.schemas, schema)
-	return &streamProto{p: m, regStateFn: regStateFn, rec: newRecord(schema.Name), schema: schema}, nil
+	m.schemasMtx.Unlock()
+
+	return &streamProto{p: m, rec: newRecord(schema.Name), schema: schema, configured: configured}, nil
 }
 
 // Close flushes remaining data (state, streams)
 func (m *proto) Close() error {
 	switch m.Cmd {
 	case integ.CmdDiscover:
-		return m.emit(integ.CATALOG, m.schemas)
-	case integ.CmdRead:
-		return m.emit(integ.STATE, m.regState)
+		return m.emit(integ.CATALOG, newCatalog(m.schemas))
 	}
 	return nil
 }
 
+// emitState registers the stream state and emits a checkpoint. The checkpoint is a
+// global state message if the state was provided in the global format, otherwise a stream state message
+func (m *proto) emitState(schema integ.Schema, v interface{}) error {
+	m.stateMtx.Lock()
+	defer m.stateMtx.Unlock()
+
+	desc := StreamDescriptor{Name: schema.Name, Namespace: schema.Namespace}
+	if _, ok := m.regState[desc]; !ok && desc.Namespace != "" {
+		delete(m.regState, StreamDescriptor{Name: schema.Name}) // the state was loaded without namespace, see LoadStream
+	}
+	m.regState[desc] = v
+
+	sharedState, global := m.SharedState()
+	if !global {
+		return m.emit(integ.STATE, StateMessage{Type: StateTypeStream, Stream: &StreamState{StreamDescriptor: desc, StreamState: v}})
+	}
+
+	var streamStates = make([]StreamState, 0, len(m.regState))
+	for desc, v := range m.regState {
+		streamStates = append(streamStates, StreamState{StreamDescriptor: desc, StreamState: v})
+	}
+	sort.Slice(streamStates, func(i, j int) bool {
+		a, b := streamStates[i].StreamDescriptor, streamStates[j].StreamDescriptor
+		return a.Namespace < b.Namespace || (a.Namespace == b.Namespace && a.Name < b.Name)
+	})
+	return m.emit(integ.STATE, StateMessage{Type: StateTypeGlobal, Global: &GlobalState{SharedState: sharedState, StreamStates: streamStates}})
+}
+
+func newCatalog(schemas []integ.Schema) Catalog {
+	var catalog = Catalog{Streams: make([]Stream, 0, len(schemas))}
+	for _, schema := range schemas {
+		catalog.Streams = append(catalog.Streams, newStream(schema))
+	}
+	return catalog
+}
+
+func newStream(schema integ.Schema) Stream {
+	configured := schema.Configured()
+	s := Stream{
+		Name:                    schema.Name,
+		JSONSchema:              schema.JsonSchema,
+		SupportedSyncModes:      []SyncMode{SyncModeFullRefresh},
+		DefaultCursorField:      configured.CursorField,
+		SourceDefinedCursor:     len(schema.OrderByKey) > 0 && !schema.CustomOrderByKey,
+		SourceDefinedPrimaryKey: configured.PrimaryKey,
+		Namespace:               schema.Namespace,
+	}
+	if schema.Incremental {
+		s.SupportedSyncModes = append(s.SupportedSyncModes, SyncModeIncremental)
+	}
+	if schema.CustomPrimaryKey {
+		s.SourceDefinedPrimaryKey = nil
+	}
+	return s
+}
+
 func (m *proto) emit(typ integ.MsgType, v interface{}) error {
 	return m.Encode(map[string]interface{}{"type": typ, strings.ToLower(string(typ)): v})
 }
@@ -6,18 +6,29 @@ import (
 )
 
 func (m *streamProto) Load(config, state interface{}) error {
-	return m.p.Load(m.schema.Name, config, state)
+	return m.p.LoadStream(integ.StreamKey{Namespace: m.schema.Namespace, Name: m.schema.Name}, config, state)
 }
 
 type streamProto struct {
 	rec        *fastjson.Value
-	regStateFn func(v interface{})
 	recBuf     []byte
 	p          *proto
 	schema     integ.Schema
+	configured integ.ConfiguredStream
+	running    bool // the RUNNING status is emitted with the first records
+}
+
+func (m *streamProto) Configured() integ.ConfiguredStream {
+	return m.configured
 }
 
 func (m *streamProto) EmitValues(arr []*fastjson.Value) error {
+	if !m.running && len(arr) > 0 {
+		m.running = true
+		if err := m.EmitStreamStatus(integ.StreamRunning); err != nil {
+			return err
+		}
+	}
 	record := m.rec.GetObject("record")
 	for _, v := range arr {
 		record.Set("data", v)
@@ -39,9 +50,12 @@ func (m *streamProto) Flush() error {
 	return m.flush(true)
 }
 
+// EmitState flushes the pending records and emits the state as a checkpoint
 func (m *streamProto) EmitState(v interface{}) error {
-	m.regStateFn(v)
-	return nil
+	if err := m.flush(true); err != nil {
+		return err
+	}
+	return m.p.emitState(m.schema, v)
 }
 
 func (m *streamProto) EmitLog(v interface{}) error {
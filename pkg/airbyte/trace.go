@@ -0,0 +1,76 @@
+package airbyte
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ajzo90/go-integ"
+)
+
+func newTrace(typ TraceType) TraceMessage {
+	return TraceMessage{Type: typ, EmittedAt: float64(time.Now().UnixMilli())}
+}
+
+// failureType maps the error category, config and auth errors are config_error, retryable errors transient_error
+func failureType(err error) FailureType {
+	switch integ.Category(err) {
+	case integ.CategoryConfig, integ.CategoryAuth:
+		return FailureTypeConfig
+	case integ.CategoryTransient, integ.CategoryRateLimited:
+		return FailureTypeTransient
+	default:
+		return FailureTypeSystem
+	}
+}
+
+// newErrorTrace creates the error trace of err, the stream is optional
+func newErrorTrace(stream *StreamDescriptor, err error) TraceMessage {
+	e := &ErrorTrace{
+		Message:          err.Error(),
+		InternalMessage:  err.Error(),
+		FailureType:      failureType(err),
+		StreamDescriptor: stream,
+	}
+	if stream != nil {
+		e.Message = fmt.Sprintf("stream %s failed: %v", stream.Name, err)
+	}
+	// panics carry the stack
+	if st, ok := err.(interface{ StackTrace() string }); ok {
+		e.StackTrace = st.StackTrace()
+	}
+
+	t := newTrace(TraceTypeError)
+	t.Error = e
+	return t
+}
+
+var _ integ.StreamTracer = &streamProto{}
+
+func (m *streamProto) descriptor() StreamDescriptor {
+	return StreamDescriptor{Name: m.schema.Name, Namespace: m.schema.Namespace}
+}
+
+// EmitError flushes the pending records and emits the error trace of the stream
+func (m *streamProto) EmitError(err error) error {
+	if err := m.flush(true); err != nil {
+		return err
+	}
+	desc := m.descriptor()
+	return m.p.emit(integ.TRACE, newErrorTrace(&desc, err))
+}
+
+func (m *streamProto) EmitEstimate(rows, bytes int64) error {
+	t := newTrace(TraceTypeEstimate)
+	t.Estimate = &EstimateTrace{Name: m.schema.Name, Namespace: m.schema.Namespace, Type: "STREAM", RowEstimate: rows, ByteEstimate: bytes}
+	return m.p.emit(integ.TRACE, t)
+}
+
+// EmitStreamStatus flushes the pending records and emits the status of the stream
+func (m *streamProto) EmitStreamStatus(status integ.StreamStatus) error {
+	if err := m.flush(true); err != nil {
+		return err
+	}
+	t := newTrace(TraceTypeStreamStatus)
+	t.StreamStatus = &StreamStatusTrace{StreamDescriptor: m.descriptor(), Status: status}
+	return m.p.emit(integ.TRACE, t)
+}
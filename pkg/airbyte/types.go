@@ -1,6 +1,11 @@
 package airbyte
 
-import "github.com/ajzo90/go-jsonschema-generator"
+import (
+	"encoding/json"
+
+	"github.com/ajzo90/go-integ"
+	"github.com/ajzo90/go-jsonschema-generator"
+)
 
 // SyncMode defines the modes that your source is able to sync in
 type SyncMode string
@@ -53,3 +58,92 @@ type ConfiguredStream struct {
 	DestinationSyncMode DestinationSyncMode `json:"destination_sync_mode"`
 	PrimaryKey          [][]string          `json:"primary_key"`
 }
+
+// StateType defines the format of a state message
+type StateType string
+
+const (
+	// StateTypeStream is the state of a single stream
+	StateTypeStream StateType = "STREAM"
+	// StateTypeGlobal is the state shared by all streams, including the state of each stream
+	StateTypeGlobal StateType = "GLOBAL"
+	// StateTypeLegacy is a single blob holding the state of all streams
+	StateTypeLegacy StateType = "LEGACY"
+)
+
+// StreamDescriptor identifies a stream
+type StreamDescriptor struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// StreamState is the state of a single stream
+type StreamState struct {
+	StreamDescriptor StreamDescriptor `json:"stream_descriptor"`
+	StreamState      interface{}      `json:"stream_state,omitempty"`
+}
+
+// GlobalState is the shared state together with the state of each stream
+type GlobalState struct {
+	SharedState  json.RawMessage `json:"shared_state,omitempty"`
+	StreamStates []StreamState   `json:"stream_states"`
+}
+
+// StateMessage is a checkpoint of the sync, the source can resume from it
+type StateMessage struct {
+	Type   StateType    `json:"type"`
+	Stream *StreamState `json:"stream,omitempty"`
+	Global *GlobalState `json:"global,omitempty"`
+	Data   interface{}  `json:"data,omitempty"`
+}
+
+// TraceType defines the kind of a trace message
+type TraceType string
+
+const (
+	TraceTypeError        TraceType = "ERROR"
+	TraceTypeEstimate     TraceType = "ESTIMATE"
+	TraceTypeStreamStatus TraceType = "STREAM_STATUS"
+)
+
+// FailureType tells the platform if an error is caused by the config, the system or a temporary failure
+type FailureType string
+
+const (
+	FailureTypeConfig    FailureType = "config_error"
+	FailureTypeSystem    FailureType = "system_error"
+	FailureTypeTransient FailureType = "transient_error"
+)
+
+// TraceMessage reports errors, estimates and the stream status to the platform
+type TraceMessage struct {
+	Type         TraceType          `json:"type"`
+	EmittedAt    float64            `json:"emitted_at"`
+	Error        *ErrorTrace        `json:"error,omitempty"`
+	Estimate     *EstimateTrace     `json:"estimate,omitempty"`
+	StreamStatus *StreamStatusTrace `json:"stream_status,omitempty"`
+}
+
+// ErrorTrace is an error that failed the sync or a stream
+type ErrorTrace struct {
+	Message          string            `json:"message"`
+	InternalMessage  string            `json:"internal_message,omitempty"`
+	StackTrace       string            `json:"stack_trace,omitempty"`
+	FailureType      FailureType       `json:"failure_type"`
+	StreamDescriptor *StreamDescriptor `json:"stream_descriptor,omitempty"`
+}
+
+// EstimateTrace is the estimated size of a stream
+type EstimateTrace struct {
+	Name         string `json:"name"`
+	Namespace    string `json:"namespace,omitempty"`
+	Type         string `json:"type"`
+	RowEstimate  int64  `json:"row_estimate,omitempty"`
+	ByteEstimate int64  `json:"byte_estimate,omitempty"`
+}
+
+// StreamStatusTrace is the status of a stream in the sync
+type StreamStatusTrace struct {
+	StreamDescriptor StreamDescriptor   `json:"stream_descriptor"`
+	Status           integ.StreamStatus `json:"status"`
+}
@@ -0,0 +1,52 @@
+package csv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+
+	"github.com/ajzo90/go-requests"
+	"github.com/valyala/fastjson"
+)
+
+type parser struct {
+	a      fastjson.Arena
+	header []string
+}
+
+// NewParser returns a parser that converts csv data to an array of objects,
+// the first row is used as keys and all values are strings
+func NewParser() requests.JSONParser {
+	return &parser{}
+}
+
+func (p *parser) ParseBytes(b []byte) (*fastjson.Value, error) {
+	p.a.Reset()
+
+	r := csv.NewReader(bytes.NewReader(b))
+	r.ReuseRecord = true
+
+	root := p.a.NewArray()
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return root, nil
+	} else if err != nil {
+		return nil, err
+	}
+	p.header = append(p.header[:0], header...)
+
+	for i := 0; ; i++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			return root, nil
+		} else if err != nil {
+			return nil, err
+		}
+		o := p.a.NewObject()
+		for j, v := range record {
+			o.Set(p.header[j], p.a.NewString(v))
+		}
+		root.SetArrayItem(i, o)
+	}
+}
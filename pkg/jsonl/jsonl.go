@@ -1,12 +1,15 @@
 package jsonl
 
 import (
+	"bytes"
+
 	"github.com/ajzo90/go-requests"
 	"github.com/valyala/fastjson"
 )
 
 type jsonl struct {
-	s fastjson.Scanner
+	// the parser is reused for every line, the values are copied to the arena
+	p fastjson.Parser
 	a fastjson.Arena
 }
 
@@ -14,15 +17,57 @@ func NewParser() requests.JSONParser {
 	return &jsonl{}
 }
 
-func (j *jsonl) ParseBytes(bytes []byte) (*fastjson.Value, error) {
+func (j *jsonl) ParseBytes(b []byte) (*fastjson.Value, error) {
 	j.a.Reset()
-	j.s.InitBytes(bytes)
 
 	root := j.a.NewArray()
 
-	for i := 0; j.s.Next(); i++ {
-		root.SetArrayItem(i, j.s.Value())
+	for i := 0; len(b) > 0; {
+		line := b
+		if idx := bytes.IndexByte(b, '\n'); idx >= 0 {
+			line, b = b[:idx], b[idx+1:]
+		} else {
+			b = nil
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		v, err := j.p.ParseBytes(line)
+		if err != nil {
+			return root, err
+		}
+		root.SetArrayItem(i, j.copy(v))
+		i++
 	}
 
-	return root, j.s.Error()
+	return root, nil
+}
+
+// copy copies v to the arena, v is only valid until the parser is reused
+func (j *jsonl) copy(v *fastjson.Value) *fastjson.Value {
+	switch v.Type() {
+	case fastjson.TypeObject:
+		o := j.a.NewObject()
+		v.GetObject().Visit(func(key []byte, v *fastjson.Value) {
+			o.Set(string(key), j.copy(v))
+		})
+		return o
+	case fastjson.TypeArray:
+		arr := j.a.NewArray()
+		for i, item := range v.GetArray() {
+			arr.SetArrayItem(i, j.copy(item))
+		}
+		return arr
+	case fastjson.TypeString:
+		return j.a.NewStringBytes(v.GetStringBytes())
+	case fastjson.TypeNumber:
+		return j.a.NewNumberString(v.String())
+	case fastjson.TypeTrue:
+		return j.a.NewTrue()
+	case fastjson.TypeFalse:
+		return j.a.NewFalse()
+	default:
+		return j.a.NewNull()
+	}
 }
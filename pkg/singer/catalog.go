@@ -0,0 +1,108 @@
+package singer
+
+import (
+	"github.com/ajzo90/go-integ"
+	"github.com/ajzo90/go-jsonschema-generator"
+)
+
+// Catalog is the singer catalog emitted by discover
+type Catalog struct {
+	Streams []CatalogStream `json:"streams"`
+}
+
+type CatalogStream struct {
+	TapStreamId   string               `json:"tap_stream_id"`
+	Stream        string               `json:"stream"`
+	Schema        *jsonschema.Document `json:"schema"`
+	KeyProperties []string             `json:"key_properties"`
+	Metadata      []Metadata           `json:"metadata"`
+}
+
+// Metadata of the stream (empty breadcrumb) or a property (["properties", name])
+type Metadata struct {
+	Breadcrumb []string               `json:"breadcrumb"`
+	Metadata   map[string]interface{} `json:"metadata"`
+}
+
+func newCatalogStream(schema integ.Schema, keys, orderBy []string) CatalogStream {
+	method := "FULL_TABLE"
+	if schema.Incremental {
+		method = "INCREMENTAL"
+	}
+	root := map[string]interface{}{
+		"inclusion":                 "available",
+		"table-key-properties":      nonNil(keys),
+		"forced-replication-method": method,
+	}
+	if len(orderBy) > 0 {
+		root["valid-replication-keys"] = orderBy
+	}
+
+	var metadata = []Metadata{{Breadcrumb: []string{}, Metadata: root}}
+	for _, k := range integ.Keys(schema.JsonSchema) {
+		inclusion := "available"
+		if contains(keys, k) || contains(orderBy, k) {
+			inclusion = "automatic"
+		}
+		metadata = append(metadata, Metadata{Breadcrumb: []string{"properties", k}, Metadata: map[string]interface{}{"inclusion": inclusion}})
+	}
+
+	return CatalogStream{
+		TapStreamId:   schema.Name,
+		Stream:        schema.Name,
+		Schema:        schema.JsonSchema,
+		KeyProperties: nonNil(keys),
+		Metadata:      metadata,
+	}
+}
+
+// loadSelection returns the selected streams of the catalog, nil if no catalog is provided. A stream is selected by
+// the "selected" metadata of the stream, or "selected" in the schema (legacy properties)
+func loadSelection(p *integ.Protocol) (map[string]bool, error) {
+	var catalog struct {
+		Streams []struct {
+			TapStreamId string `json:"tap_stream_id"`
+			Stream      string `json:"stream"`
+			Schema      struct {
+				Selected bool `json:"selected"`
+			} `json:"schema"`
+			Metadata []Metadata `json:"metadata"`
+		} `json:"streams"`
+	}
+	if ok, err := p.Catalog(&catalog); err != nil || !ok {
+		return nil, err
+	}
+
+	var selected = map[string]bool{}
+	for _, s := range catalog.Streams {
+		name := s.TapStreamId
+		if name == "" {
+			name = s.Stream
+		}
+		selected[name] = s.Schema.Selected
+		for _, m := range s.Metadata {
+			if len(m.Breadcrumb) == 0 {
+				if v, ok := m.Metadata["selected"].(bool); ok {
+					selected[name] = v
+				}
+			}
+		}
+	}
+	return selected, nil
+}
+
+func nonNil[T any](arr []T) []T {
+	if arr == nil {
+		return []T{}
+	}
+	return arr
+}
+
+func contains(arr []string, s string) bool {
+	for _, v := range arr {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
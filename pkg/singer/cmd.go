@@ -0,0 +1,73 @@
+package singer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/ajzo90/go-integ"
+)
+
+// Tap runs the loader as a singer tap:
+//
+//	tap --config config.json --discover
+//	tap --config config.json [--state state.json] [--catalog catalog.json | --properties properties.json]
+func Tap(loader integ.Loader) {
+	if err := cmd(os.Args, loader, os.Stdout); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func cmd(args []string, loader integ.Loader, w io.Writer) error {
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	config := flags.String("config", "", "config file")
+	state := flags.String("state", "", "state file")
+	catalog := flags.String("catalog", "", "catalog file")
+	properties := flags.String("properties", "", "properties file (legacy catalog)")
+	discover := flags.Bool("discover", false, "emit the catalog")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	} else if *config == "" {
+		return fmt.Errorf("usage: %s --config config [--discover] [--state state] [--catalog catalog]", args[0])
+	} else if *catalog == "" {
+		*catalog = *properties
+	}
+
+	cmd := integ.CmdRead
+	if *discover {
+		cmd = integ.CmdDiscover
+	}
+
+	b := bytes.NewBuffer(nil)
+	enc := json.NewEncoder(b)
+	if err := enc.Encode(map[string]any{"type": "SETTINGS", "settings": map[string]interface{}{"format": "singer"}}); err != nil {
+		return err
+	}
+
+	for _, f := range []struct {
+		file string
+		typ  integ.MsgType
+		key  string
+	}{{*config, integ.CONFIG, "config"}, {*state, integ.STATE, "state"}, {*catalog, integ.CATALOG, "catalog"}} {
+		if f.file == "" {
+			continue
+		}
+		data, err := os.ReadFile(f.file)
+		if err != nil {
+			return err
+		} else if !json.Valid(data) {
+			return fmt.Errorf("invalid json in %s", f.file)
+		} else if err := enc.Encode(map[string]any{"type": f.typ, f.key: json.RawMessage(data)}); err != nil {
+			return err
+		}
+	}
+
+	return loader.Handle(context.Background(), cmd, w, bytes.NewReader(b.Bytes()), integ.Protos{
+		"singer": Proto,
+	})
+}
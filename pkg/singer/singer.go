@@ -1,7 +1,9 @@
 package singer
 
 import (
+	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ajzo90/go-integ"
@@ -10,19 +12,36 @@ import (
 )
 
 var Proto integ.ProtoFn = func(p *integ.Protocol) integ.Proto {
-	return &singer{Protocol: p}
+	m := &singer{Protocol: p, bookmarks: map[string]interface{}{}}
+	// singer streams have no namespace
+	for key, state := range p.States() {
+		m.bookmarks[key.Name] = state
+	}
+	m.selected, m.catalogErr = loadSelection(p)
+	return m
 }
 
 type singer struct {
 	*integ.Protocol
+	streamsMtx sync.Mutex
+	streams    []CatalogStream
+	selected   map[string]bool // nil if no catalog is provided
+	catalogErr error
+	stateMtx   sync.Mutex
+	bookmarks  map[string]interface{}
 }
 
-func newRecordSerializer(stream string) func(buf []byte, v *fastjson.Value) []byte {
+// newRecordSerializer serializes the records of the stream, the version is set on records of full table
+// streams (version > 0)
+func newRecordSerializer(stream string, version int64) func(buf []byte, v *fastjson.Value) []byte {
 	var staticArena, localArena fastjson.Arena
 
 	o := staticArena.NewObject()
 	o.Set("type", staticArena.NewString(string(integ.RECORD)))
 	o.Set("stream", staticArena.NewString(stream))
+	if version > 0 {
+		o.Set("version", staticArena.NewNumberInt(int(version)))
+	}
 
 	return func(buf []byte, v *fastjson.Value) []byte {
 		localArena.Reset()
@@ -43,28 +62,72 @@ type schemaMsg struct {
 func (m *singer) Open(schema integ.Schema) (integ.StreamProto, error) {
 	// emit stream info. number of records?
 
+	// singer key properties are top level properties, nested keys are dropped
 	var extractKey = func(fields []integ.FieldDef) []string {
-		var out = make([]string, len(fields))
-		for i, f := range fields {
-			out[i] = f.Path[0]
+		var out = make([]string, 0, len(fields))
+		for _, f := range fields {
+			if len(f.Path) != 1 {
+				log.Printf("stream %s: nested key %s is not supported by singer, dropped from the key properties", schema.Name, strings.Join(f.Path, "."))
+				continue
+			}
+			out = append(out, f.Path[0])
 		}
 		return out
 	}
 
+	keys, orderBy := extractKey(schema.PrimaryKey), extractKey(schema.OrderByKey)
+
+	if m.Cmd == integ.CmdDiscover {
+		m.streamsMtx.Lock()
+		m.streams = append(m.streams, newCatalogStream(schema, keys, orderBy))
+		m.streamsMtx.Unlock()
+		return &singerStream{p: m, schema: schema}, nil
+	} else if m.catalogErr != nil {
+		return nil, m.catalogErr
+	} else if m.selected != nil && !m.selected[schema.Name] {
+		return nil, nil
+	}
+
 	err := m.Encode(schemaMsg{
 		Type:              string(integ.SCHEMA),
 		Stream:            schema.Name,
-		KeyProperties:     extractKey(schema.PrimaryKey),
-		OrderByProperties: extractKey(schema.OrderByKey),
+		KeyProperties:     keys,
+		OrderByProperties: orderBy,
 		Schema:            schema.JsonSchema,
 	})
 
-	return &singerStream{p: m, serialize: newRecordSerializer(schema.Name), schema: schema}, err
+	// full table streams are versioned, the version is activated when the stream completes
+	var version int64
+	if !schema.Incremental {
+		version = time.Now().UnixMilli()
+	}
+	return &singerStream{p: m, serialize: newRecordSerializer(schema.Name, version), schema: schema, version: version}, err
+}
+
+// emitState registers the stream state and emits the state of all streams, {"bookmarks":{"stream":{...}}}
+func (m *singer) emitState(stream string, v interface{}) error {
+	type singerState struct {
+		Type  string `json:"type"`
+		Value struct {
+			Bookmarks map[string]interface{} `json:"bookmarks"`
+		} `json:"value"`
+	}
+
+	m.stateMtx.Lock()
+	defer m.stateMtx.Unlock()
+	m.bookmarks[stream] = v
+
+	var msg = singerState{Type: string(integ.STATE)}
+	msg.Value.Bookmarks = m.bookmarks
+	return m.Encode(msg)
 }
 
 // Close flushes remaining data (state, streams)
 func (m *singer) Close() error {
-	// summary?
+	switch m.Cmd {
+	case integ.CmdDiscover:
+		return m.Encode(Catalog{Streams: nonNil(m.streams)})
+	}
 	return nil
 }
 
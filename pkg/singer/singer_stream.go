@@ -8,7 +8,7 @@ import (
 )
 
 func (m *singerStream) Load(config, state interface{}) error {
-	return m.p.Load(m.schema.Name, config, state)
+	return m.p.LoadStream(integ.StreamKey{Namespace: m.schema.Namespace, Name: m.schema.Name}, config, state)
 }
 
 type singerStream struct {
@@ -16,6 +16,11 @@ type singerStream struct {
 	recBuf    []byte
 	p         *singer
 	schema    integ.Schema
+	version   int64 // full table version, 0 for incremental streams
+}
+
+func (m *singerStream) Configured() integ.ConfiguredStream {
+	return m.schema.Configured()
 }
 
 func (m *singerStream) EmitValues(arr []*fastjson.Value) error {
@@ -34,48 +39,52 @@ func (m *singerStream) flush(forcedFlush bool) error {
 	return nil
 }
 
+// Flush is called when the stream completes, the version of a full table stream is activated:
+// the target drops the records of previous versions
 func (m *singerStream) Flush() error {
-	return m.flush(true)
-}
-
-func (m *singerStream) EmitState(v interface{}) error {
+	if err := m.flush(true); err != nil || m.version == 0 {
+		return err
+	}
 
-	type singerState struct {
-		Type   string `json:"type"`
-		Stream string `json:"stream"`
-		State  any    `json:"state"`
+	type activateVersion struct {
+		Type    string `json:"type"`
+		Stream  string `json:"stream"`
+		Version int64  `json:"version"`
 	}
+	return m.p.Encode(activateVersion{Type: string(integ.ACTIVATE_VERSION), Stream: m.schema.Name, Version: m.version})
+}
 
+func (m *singerStream) EmitState(v interface{}) error {
 	if err := m.flush(true); err != nil {
 		return err
 	}
-
-	return m.p.Encode(singerState{
-		Type:   string(integ.STATE),
-		Stream: m.schema.Name,
-		State:  v,
-	})
+	return m.p.emitState(m.schema.Name, v)
 }
 
 func (m *singerStream) EmitLog(v interface{}) error {
 
 	type singerLog struct {
-		Type      string `json:"type"`
-		Timestamp int64  `json:"timestamp"`
-		Stream    string `json:"stream"`
-		Log       any    `json:"log"`
+		Type      string              `json:"type"`
+		Timestamp int64               `json:"timestamp"`
+		Stream    string              `json:"stream"`
+		Log       any                 `json:"log"`
+		Category  integ.ErrorCategory `json:"category,omitempty"`
 	}
 
 	if err := m.flush(true); err != nil {
 		return err
 	}
 
-	return m.p.Encode(singerLog{
+	msg := singerLog{
 		Type:      string(integ.LOG),
 		Stream:    m.schema.Name,
 		Log:       logErr(v),
 		Timestamp: time.Now().Unix(),
-	})
+	}
+	if err, ok := v.(error); ok {
+		msg.Category = integ.Category(err)
+	}
+	return m.p.Encode(msg)
 }
 
 func logErr(v any) any {
@@ -0,0 +1,203 @@
+package singer
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ajzo90/go-integ"
+)
+
+type testConfig struct {
+	Url string `json:"url"`
+}
+
+func emitName(ctx integ.HttpContext) error {
+	if err := ctx.Load(&testConfig{}, nil); err != nil {
+		return err
+	}
+	return ctx.EmitValue(map[string]string{"name": ctx.Schema().Name})
+}
+
+func testSource() integ.Loader {
+	type rec struct {
+		Name string `json:"name"`
+	}
+	return integ.NewSource(testConfig{}).
+		HttpStream(integ.Incremental("users", rec{}).CustomOrderBy().Primary(integ.Field("name")), integ.HttpRunnerFunc(emitName)).
+		HttpStream(integ.Incremental("orders", rec{}).CustomOrderBy(), integ.HttpRunnerFunc(emitName))
+}
+
+func writeFile(t *testing.T, name, data string) string {
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestDiscover(t *testing.T) {
+	var w bytes.Buffer
+	if err := cmd([]string{"x", "--config", writeFile(t, "config.json", `{"url":"x"}`), "--discover"}, testSource(), &w); err != nil {
+		t.Fatal(err)
+	}
+
+	// the catalog is the only output
+	dec := json.NewDecoder(bytes.NewReader(w.Bytes()))
+	var catalog Catalog
+	if err := dec.Decode(&catalog); err != nil {
+		t.Fatal(err)
+	} else if dec.More() {
+		t.Errorf("expected one json document: %s", w.String())
+	} else if len(catalog.Streams) != 2 {
+		t.Errorf("expected 2 streams, got %d", len(catalog.Streams))
+	}
+
+	out := w.String()
+	for _, s := range []string{
+		`"tap_stream_id":"users"`,
+		`"key_properties":["name"]`,
+		`{"breadcrumb":[],"metadata":{"forced-replication-method":"INCREMENTAL","inclusion":"available","table-key-properties":["name"]}}`,
+		`{"breadcrumb":["properties","name"],"metadata":{"inclusion":"automatic"}}`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected %s in %s", s, out)
+		}
+	}
+	if strings.Contains(out, `"type":"RECORD"`) {
+		t.Errorf("records emitted in discover: %s", out)
+	}
+}
+
+func TestNestedKey(t *testing.T) {
+	type item struct {
+		PartNo  string `json:"part_no"`
+		Product struct {
+			Id int `json:"id"`
+		} `json:"product"`
+	}
+	src := integ.NewSource(testConfig{}).
+		HttpStream(integ.NonIncremental("items", item{}).Primary(integ.Field("part_no"), integ.Field("product", "id")), integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+			return ctx.EmitValue(item{PartNo: "x"})
+		}))
+
+	config := writeFile(t, "config.json", `{"url":"x"}`)
+	for _, args := range [][]string{{"x", "--config", config, "--discover"}, {"x", "--config", config}} {
+		var w bytes.Buffer
+		if err := cmd(args, src, &w); err != nil {
+			t.Fatal(err)
+		}
+		// the nested key is dropped, singer keys are top level properties
+		if out := w.String(); !strings.Contains(out, `"key_properties":["part_no"]`) {
+			t.Errorf("expected the top level key in %s", out)
+		} else if args[len(args)-1] == config && !strings.Contains(out, `"record":{"part_no":"x","product":{"id":0}}`) {
+			t.Errorf("expected the record in %s", out)
+		}
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	src := integ.NewSource(testConfig{}).
+		HttpStream(integ.Incremental("users", struct{}{}).CustomOrderBy(), integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+			ctx.CheckpointEvery(2, 0)
+			for i := 1; i <= 3; i++ {
+				if err := ctx.EmitValue(map[string]int{"i": i}); err != nil {
+					return err
+				}
+				ctx.SetCursor(map[string]int{"i": i})
+			}
+			return nil
+		}))
+
+	var w bytes.Buffer
+	if err := cmd([]string{"x", "--config", writeFile(t, "config.json", `{"url":"x"}`)}, src, &w); err != nil {
+		t.Fatal(err)
+	}
+
+	var states []string
+	for _, line := range strings.Split(strings.TrimSpace(w.String()), "\n") {
+		if strings.Contains(line, `"type":"STATE"`) {
+			states = append(states, line)
+		}
+	}
+	// checkpoint after the second record (with the cursor of the first) and when the stream completes
+	expected := []string{
+		`{"type":"STATE","value":{"bookmarks":{"users":{"i":1}}}}`,
+		`{"type":"STATE","value":{"bookmarks":{"users":{"i":3}}}}`,
+	}
+	if strings.Join(states, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected states %v, got %v", expected, states)
+	}
+}
+
+func TestReadCatalog(t *testing.T) {
+	const catalog = `{"streams":[
+		{"tap_stream_id":"users","metadata":[{"breadcrumb":[],"metadata":{"selected":false}}]},
+		{"tap_stream_id":"orders","metadata":[{"breadcrumb":[],"metadata":{"selected":true}}]}
+	]}`
+
+	for _, flag := range []string{"--catalog", "--properties"} {
+		var w bytes.Buffer
+		if err := cmd([]string{"x", "--config", writeFile(t, "config.json", `{"url":"x"}`), flag, writeFile(t, "catalog.json", catalog)}, testSource(), &w); err != nil {
+			t.Fatal(err)
+		}
+
+		out := w.String()
+		if strings.Contains(out, `"stream":"users"`) {
+			t.Errorf("%s: unselected stream emitted: %s", flag, out)
+		} else if !strings.Contains(out, `"record":{"name":"orders"}`) {
+			t.Errorf("%s: expected orders: %s", flag, out)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	type state struct {
+		N int `json:"n"`
+	}
+	type rec struct {
+		Id int `json:"id"`
+	}
+	src := integ.NewSource(testConfig{}).
+		HttpStream(integ.Incremental("users", rec{}).CustomOrderBy(), integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+			var s state
+			if err := ctx.Load(&testConfig{}, &s); err != nil {
+				return err
+			} else if err := ctx.EmitValue(rec{Id: s.N}); err != nil {
+				return err
+			}
+			return ctx.EmitState(state{N: s.N + 1})
+		})).
+		HttpStream(integ.NonIncremental("products", rec{}), integ.HttpRunnerFunc(func(ctx integ.HttpContext) error {
+			return ctx.EmitValue(rec{Id: 1})
+		}))
+
+	var w bytes.Buffer
+	args := []string{"x", "--config", writeFile(t, "config.json", `{"url":"x"}`), "--state", writeFile(t, "state.json", `{"bookmarks":{"users":{"n":5},"orders":{"n":2}}}`)}
+	if err := cmd(args, src, &w); err != nil {
+		t.Fatal(err)
+	}
+
+	out := w.String()
+	for _, s := range []string{
+		`"record":{"id":5}`,
+		`{"type":"STATE","value":{"bookmarks":{"orders":{"n":2},"users":{"n":6}}}}`,
+		`{"type":"ACTIVATE_VERSION","stream":"products","version":`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected %s in %s", s, out)
+		}
+	}
+
+	// the full table records have the activated version
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, `"stream":"products"`) && strings.Contains(line, `"type":"RECORD"`) && !strings.Contains(line, `"version":`) {
+			t.Errorf("expected version in %s", line)
+		} else if strings.Contains(line, `"stream":"users"`) && strings.Contains(line, `"version":`) {
+			t.Errorf("unexpected version in %s", line)
+		}
+	}
+}
@@ -5,11 +5,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"strings"
 
 	"github.com/ajzo90/go-jsonschema-generator"
@@ -34,16 +37,46 @@ func (r ManualRunnerFunc) Run(ctx ManualContext) error {
 	return r(ctx)
 }
 
+type FsRunnerFunc func(ctx FsContext) error
+
+func (r FsRunnerFunc) Run(ctx FsContext) error {
+	return r(ctx)
+}
+
+type DbRunnerFunc func(ctx DbContext) error
+
+func (r DbRunnerFunc) Run(ctx DbContext) error {
+	return r(ctx)
+}
+
+type GeneralRunnerFunc func(ctx GeneralContext) error
+
+func (r GeneralRunnerFunc) Run(ctx GeneralContext) error {
+	return r(ctx)
+}
+
 type Streams []Schema
 
+// singerFormat is the format of the singer protocol, the global state of singer holds the stream states in bookmarks
+const singerFormat = "singer"
+
 type Settings struct {
 	Format  string
 	Streams Streams
 }
 
 func Open(r io.Reader, w io.Writer, cmd Command, protos Protos) (Proto, error) {
+	i, err := parseProtocol(r, w, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return i.open(protos)
+}
+
+// parseProtocol reads the input messages (settings, config, state and catalog)
+func parseProtocol(r io.Reader, w io.Writer, cmd Command) (*Protocol, error) {
 	var p fastjson.Parser
-	i := &Protocol{states: map[string][]byte{}, _w: w, Cmd: cmd}
+	i := &Protocol{states: map[StreamKey][]byte{}, _w: w, Cmd: cmd}
 	var buf []byte
 
 	marshal := func(v *fastjson.Value) []byte {
@@ -74,10 +107,13 @@ func Open(r io.Reader, w io.Writer, cmd Command, protos Protos) (Proto, error) {
 		case CONFIG:
 			i.config = marshal(v.Get("config"))
 		case STATE:
-			stream := string(v.GetStringBytes("stream"))
-			i.states[stream] = marshal(v.Get("state"))
+			if stream := v.GetStringBytes("stream"); len(stream) > 0 {
+				i.states[StreamKey{Namespace: string(v.GetStringBytes("namespace")), Name: string(stream)}] = marshal(v.Get("state"))
+			} else if err := i.loadStates(v.Get("state"), marshal); err != nil {
+				return nil, err
+			}
 		case CATALOG:
-
+			i.catalog = marshal(v.Get("catalog"))
 		default:
 			return nil, fmt.Errorf("invalid type '%s'", t)
 		}
@@ -87,19 +123,30 @@ func Open(r io.Reader, w io.Writer, cmd Command, protos Protos) (Proto, error) {
 		return nil, err
 	}
 
-	useGlobalState := len(i.states[""]) > 0
+	useGlobalState := len(i.states[StreamKey{}]) > 0
 	if useGlobalState {
 		states := map[string]json.RawMessage{}
 
-		if err := json.NewDecoder(bytes.NewReader(i.states[""])).Decode(&states); err != nil {
-			panic(err)
+		if err := json.NewDecoder(bytes.NewReader(i.states[StreamKey{}])).Decode(&states); err != nil {
+			return nil, err
+		}
+		// singer state, the stream states are bookmarks: {"bookmarks":{"users":{...}}}
+		if bookmarks, ok := states["bookmarks"]; ok && i.settings.Format == singerFormat {
+			states = map[string]json.RawMessage{}
+			if err := json.Unmarshal(bookmarks, &states); err != nil {
+				return nil, fmt.Errorf("invalid bookmarks: %w", err)
+			}
 		}
-		delete(i.states, "")
+		delete(i.states, StreamKey{})
 		for k, v := range states {
-			i.states[k] = v
+			i.states[StreamKey{Name: k}] = v
 		}
 	}
+	return i, nil
+}
 
+// open creates the proto for the format in the settings
+func (i *Protocol) open(protos Protos) (Proto, error) {
 	fn, ok := protos[i.settings.Format]
 	if !ok {
 		return nil, fmt.Errorf("not supported")
@@ -107,12 +154,61 @@ func Open(r io.Reader, w io.Writer, cmd Command, protos Protos) (Proto, error) {
 	return fn(i), nil
 }
 
+// loadStates loads the legacy state (a map of stream states) or
+// airbyte state messages (STREAM/GLOBAL/LEGACY), as a single message or a list of messages
+func (i *Protocol) loadStates(v *fastjson.Value, marshal func(v *fastjson.Value) []byte) error {
+	if v == nil {
+		return nil
+	} else if v.Type() == fastjson.TypeArray {
+		for _, msg := range v.GetArray() {
+			if err := i.loadStateMsg(msg, marshal); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch string(v.GetStringBytes("type")) {
+	case "STREAM", "GLOBAL", "LEGACY":
+		return i.loadStateMsg(v, marshal)
+	default:
+		i.states[StreamKey{}] = marshal(v)
+		return nil
+	}
+}
+
+func (i *Protocol) loadStateMsg(v *fastjson.Value, marshal func(v *fastjson.Value) []byte) error {
+	switch t := string(v.GetStringBytes("type")); t {
+	case "STREAM":
+		i.states[streamKey(v.Get("stream", "stream_descriptor"))] = marshal(v.Get("stream", "stream_state"))
+	case "GLOBAL":
+		i.globalState = true
+		i.sharedState = marshal(v.Get("global", "shared_state"))
+		for _, st := range v.GetArray("global", "stream_states") {
+			i.states[streamKey(st.Get("stream_descriptor"))] = marshal(st.Get("stream_state"))
+		}
+	case "LEGACY", "":
+		i.states[StreamKey{}] = marshal(v.Get("data"))
+	default:
+		return fmt.Errorf("invalid state type '%s'", t)
+	}
+	return nil
+}
+
+// streamKey reads the key of an airbyte stream descriptor
+func streamKey(desc *fastjson.Value) StreamKey {
+	return StreamKey{Namespace: string(desc.GetStringBytes("namespace")), Name: string(desc.GetStringBytes("name"))}
+}
+
 type (
 	runners   []runnerTyp
 	runnerTyp struct {
-		httpRunner HttpRunner
-		fsRunner   FsRunner
-		schema     Schema
+		httpRunner    HttpRunner
+		fsRunner      FsRunner
+		dbRunner      DbRunner
+		generalRunner GeneralRunner
+		schema        Schema
+		noRecover     bool // panics are not recovered, see sourceDef.RecoverPanics
 	}
 )
 
@@ -135,6 +231,8 @@ const (
 	CATALOG           MsgType = "CATALOG"
 	SPEC              MsgType = "SPEC"
 	SCHEMA            MsgType = "SCHEMA"
+	TRACE             MsgType = "TRACE"
+	ACTIVATE_VERSION  MsgType = "ACTIVATE_VERSION"
 
 	CONFIG   MsgType = "CONFIG"
 	SETTINGS MsgType = "SETTINGS"
@@ -191,50 +289,134 @@ func serveLoader(loader Loader, protos Protos) http.HandlerFunc {
 		p := strings.Split(request.URL.Path, "/")
 		last := p[len(p)-1]
 
-		var wc io.WriteCloser = nopCloser{w: writer}
+		// the response is buffered until it is large enough, so that the status of early failures reflects the error
+		rb := &responseBuffer{w: writer, size: 64 << 10}
+		var wc io.WriteCloser = nopCloser{w: rb}
 
 		var useZstd = request.Header.Get("Accept-Zstd") != ""
 		if useZstd {
 			writer.Header().Add("X-Compression", "zstd")
 			zW, err := zstd.NewWriter(wc)
 			if err != nil {
-				panic(err)
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
 			}
 			wc = zW
 		}
 
-		if err := loader.Handle(request.Context(), Command(last), wc, request.Body, protos); err != nil {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
+		if err := loader.Handle(request.Context(), Command(last), wc, request.Body, protos); err != nil && !rb.committed {
+			// the status tells the caller if the request can be retried, the buffered output is discarded
+			writer.Header().Del("X-Compression")
+			if d := RetryAfter(err); d > 0 {
+				writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+			}
+			http.Error(writer, err.Error(), httpStatus(err))
+		} else if err != nil {
+			// the status is sent
+			log.Println("handle:", err)
 		} else if err := wc.Close(); err != nil {
-			panic(err)
+			log.Println("close response:", err)
+		} else if err := rb.flush(); err != nil {
+			log.Println("flush response:", err)
 		}
 	}
 }
 
-type panicErr string
+// responseBuffer buffers the response until size bytes are written
+type responseBuffer struct {
+	w         io.Writer
+	buf       bytes.Buffer
+	size      int
+	committed bool
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	if b.committed {
+		return b.w.Write(p)
+	}
+	b.buf.Write(p)
+	if b.buf.Len() >= b.size {
+		if err := b.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flush writes the buffered response, the response is committed
+func (b *responseBuffer) flush() error {
+	b.committed = true
+	_, err := b.w.Write(b.buf.Bytes())
+	b.buf.Reset()
+	return err
+}
+
+// panicErr is a recovered panic of a runner
+type panicErr struct {
+	v     interface{}
+	stack []byte
+}
 
 func (p panicErr) Error() string {
-	return string(p)
+	return fmt.Sprintf("panic: %v", p.v)
 }
 
-type validatorLoader struct {
-	httpRunContext
+// StackTrace returns the stack of the panic, reported in error traces
+func (p panicErr) StackTrace() string {
+	return string(p.stack)
 }
 
-func (m *validatorLoader) EmitBatch(req *requests.Request, resp *requests.JSONResponse, path ...string) error {
-	if err := req.Extended().ExecJSONPreAlloc(resp, m.ctx); err != nil {
-		return err
-	} else {
-		return validatorOK
+// recoverPanic converts a panic into a panicErr if enabled, used as: defer recoverPanic(enabled, &err)
+func recoverPanic(enabled bool, err *error) {
+	if !enabled {
+		return
+	} else if v := recover(); v != nil {
+		*err = panicErr{v: v, stack: debug.Stack()}
+	}
+}
+
+// streamFailure is a stream failure that fails the sync when the other streams complete
+type streamFailure struct {
+	err      error
+	reported bool // emitted as error of the stream
+}
+
+// Reported returns true if err, and every aggregated error, is a stream failure already emitted as error of
+// the stream. The protocols use it to not report the failure again for the sync
+func Reported(err error) bool {
+	var list errorList
+	var f *streamFailure
+	if errors.As(err, &list) {
+		for _, err := range list {
+			if !Reported(err) {
+				return false
+			}
+		}
+		return len(list) > 0
 	}
+	return errors.As(err, &f) && f.reported
+}
+
+func (f *streamFailure) Error() string {
+	return f.err.Error()
 }
 
-var validatorOK = fmt.Errorf("validatorOK")
+func (f *streamFailure) Unwrap() error {
+	return f.err
+}
 
 type baseRunContext struct {
 	ctx    context.Context
 	schema Schema
 	StreamProto
+	cp      checkpointer
+	coercer *coercer
+	drift   *driftDetector
+	records *recordValidator
+	related map[string]*relatedCtx
+	arena   fastjson.Arena
+
+	noRecover bool // panics of FanOut calls are not recovered
 }
 
 func makeBaseRunCtx(ctx context.Context, schema Schema, sp StreamProto) baseRunContext {
@@ -245,11 +427,32 @@ func (r *baseRunContext) Schema() Schema {
 	return r.schema
 }
 
+func (r *baseRunContext) EmitEstimate(rows, bytes int64) error {
+	if t, ok := r.StreamProto.(StreamTracer); ok {
+		return t.EmitEstimate(rows, bytes)
+	}
+	return nil
+}
+
 func (r *baseRunContext) EmitValues(values []*fastjson.Value) error {
-	if err := r.ctx.Err(); err != nil {
+	var err error
+	if err = r.ctx.Err(); err != nil {
+		return err
+	} else if r.coercer != nil {
+		r.coercer.coerceValues(values)
+	}
+	if r.drift != nil {
+		r.drift.observeValues(values)
+	}
+	if r.records != nil {
+		if values, err = r.records.filter(values); err != nil {
+			return err
+		}
+	}
+	if err = r.StreamProto.EmitValues(values); err != nil {
 		return err
 	}
-	return r.StreamProto.EmitValues(values)
+	return r.checkpoint(len(values), false)
 }
 
 func (r *baseRunContext) EmitValue(value any) error {
@@ -258,6 +461,9 @@ func (r *baseRunContext) EmitValue(value any) error {
 		return r.EmitValues([]*fastjson.Value{t})
 	case []*fastjson.Value:
 		return r.EmitValues(t)
+	case FastJSONMarshaler:
+		r.arena.Reset()
+		return r.EmitValues([]*fastjson.Value{t.MarshalFastJSON(&r.arena)})
 	default:
 		b, err := json.Marshal([]any{value})
 		if err != nil {
@@ -300,46 +506,150 @@ type ConnectorSpecification struct {
 	DocumentationURL        string               `json:"documentationUrl,omitempty"`
 	SupportsIncremental     bool                 `json:"supportsIncremental"`
 	ConnectionSpecification *jsonschema.Document `json:"connectionSpecification"`
+
+	// config is the config type of the document, the enum and default tags are added to the emitted spec
+	config interface{}
+}
+
+// MarshalJSON emits the connection specification extended with the tags of the config type, the schema
+// ValidateConfig validates against
+func (s ConnectorSpecification) MarshalJSON() ([]byte, error) {
+	var spec interface{} = s.ConnectionSpecification
+	if s.config != nil && s.ConnectionSpecification != nil {
+		js, err := specSchema(s.ConnectionSpecification, s.config)
+		if err != nil {
+			return nil, err
+		}
+		spec = js
+	}
+	return json.Marshal(struct {
+		DocumentationURL        string      `json:"documentationUrl,omitempty"`
+		SupportsIncremental     bool        `json:"supportsIncremental"`
+		ConnectionSpecification interface{} `json:"connectionSpecification"`
+	}{s.DocumentationURL, s.SupportsIncremental, spec})
 }
 
 func run(ctx context.Context, proto Proto, runner runnerTyp, sync bool) (err error) {
-	sp, err := proto.Open(runner.schema)
+	set, ok, err := openStreams(proto, runner.schema)
 	if err != nil {
 		return err
-	} else if sp == nil {
+	} else if !ok {
 		// skip stream
 		return nil
 	}
+	sp := set.sp
 
 	defer func() {
-		const useRecover = false
-		if useRecover {
-			if pErr := recover(); pErr != nil {
-				s := debug.Stack()
-				log.Println(string(s))
-				err = panicErr(s)
-			}
-		}
-
 		if err == nil {
-			err = sp.Flush()
+			err = set.flush()
+		}
+		if cErr := set.deadLetterFile.Close(); err == nil {
+			err = cErr
 		}
 
-		// check err again
+		// check err again. The error is reported on the stream, panics and categorized errors also fail the sync
+		// when the other streams complete
+		var status, failure = StreamComplete, error(nil)
+		var pErr panicErr
+		if errors.As(err, &pErr) {
+			log.Printf("stream %s: %v\n%s", runner.schema.Name, pErr, pErr.stack)
+			failure = &streamFailure{err: fmt.Errorf("stream %s: %w", runner.schema.Name, err), reported: true}
+		} else if categorized(err) {
+			failure = &streamFailure{err: fmt.Errorf("stream %s: %w", runner.schema.Name, err), reported: true}
+		}
 		if err != nil {
-			err = sp.EmitLog(err)
+			status, err = StreamIncomplete, emitError(sp, err)
+		}
+		if sync && err == nil {
+			err = set.emitStatus(status)
+		}
+		if err == nil {
+			err = failure
 		}
 	}()
+	defer recoverPanic(!runner.noRecover, &err)
 
 	if sync {
-		if runner.httpRunner != nil {
-			runCtx := newHTTPRunCtx(ctx, runner.schema, sp)
-			return runner.httpRunner.Run(runCtx)
-		} else if runner.fsRunner != nil {
-			return fmt.Errorf("fs runner not implemented")
-		} else {
-			return fmt.Errorf("runner not implemented")
+		if err := set.emitStatus(StreamStarted); err != nil {
+			return err
 		}
+		return runStream(ctx, runner, set)
+	}
+	return nil
+}
+
+// emitError reports the error of the stream as a log message, and as a trace if supported by the proto
+func emitError(sp StreamProto, err error) error {
+	if t, ok := sp.(StreamTracer); ok {
+		if err := t.EmitError(err); err != nil {
+			return err
+		}
+	}
+	return sp.EmitLog(err)
+}
+
+// runStream runs the stream runner, the registered cursor is emitted when the runner completes
+func runStream(ctx context.Context, runner runnerTyp, set streamSet) error {
+	sp := set.sp
+	var runCtx *baseRunContext
+	var runFn func() error
+	switch {
+	case runner.httpRunner != nil:
+		c := newHTTPRunCtx(ctx, runner.schema, sp)
+		runCtx, runFn = &c.baseRunContext, func() error { return runner.httpRunner.Run(c) }
+	case runner.fsRunner != nil:
+		c := newFsRunCtx(ctx, runner.schema, sp)
+		runCtx, runFn = &c.baseRunContext, func() error { return runner.fsRunner.Run(c) }
+	case runner.dbRunner != nil:
+		c := newDbRunCtx(ctx, runner.schema, sp)
+		runCtx, runFn = &c.baseRunContext, func() error { return runner.dbRunner.Run(c) }
+	case runner.generalRunner != nil:
+		c := makeBaseRunCtx(ctx, runner.schema, sp)
+		runCtx, runFn = &c, func() error { return runner.generalRunner.Run(&c) }
+	default:
+		return fmt.Errorf("runner not implemented")
+	}
+	runCtx.noRecover = runner.noRecover
+
+	if err := runCtx.setup(set); err != nil {
+		return err
+	} else if err := runFn(); err != nil {
+		return err
+	} else if err := runCtx.completeRelated(); err != nil {
+		return err
+	} else if err := runCtx.checkpoint(0, true); err != nil {
+		return err
+	}
+	return runCtx.report()
+}
+
+// setup enables coercion, drift detection and validation of the records, if configured in the schema,
+// and creates the contexts of the related streams. Invalid records are emitted to the dead letter stream (optional)
+func (r *baseRunContext) setup(set streamSet) (err error) {
+	if r.coercer, err = newCoercer(r.schema); err != nil {
+		return err
+	} else if r.drift, err = newDriftDetector(r.schema); err != nil {
+		return err
+	} else if r.records, err = newRecordValidator(r.schema, set); err != nil {
+		return err
+	}
+	return r.setupRelated(set.related)
+}
+
+// report logs the stream stats, fails if the schema drift exceeds the threshold
+func (r *baseRunContext) report() error {
+	if r.coercer != nil {
+		if err := r.coercer.report(r.StreamProto); err != nil {
+			return err
+		}
+	}
+	if r.records != nil {
+		if err := r.records.report(r.StreamProto); err != nil {
+			return err
+		}
+	}
+	if r.drift != nil {
+		return r.drift.report(r.StreamProto)
 	}
 	return nil
 }
@@ -5,16 +5,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"reflect"
 	"sync"
+
+	"github.com/valyala/fastjson"
 )
 
 type Protocol struct {
 	Cmd      Command
 	settings Settings
 	config   []byte
-	states   map[string][]byte
+	catalog  []byte
+	states   map[StreamKey][]byte
 	_w       io.Writer
 	wMtx     sync.Mutex
+
+	globalState bool
+	sharedState []byte
 }
 
 func (i *Protocol) Encode(v interface{}) error {
@@ -32,22 +39,90 @@ func (i *Protocol) Write(b []byte) error {
 	return err
 }
 
+// StreamKey identifies the state of a stream, the name qualified by the namespace
+type StreamKey struct {
+	Namespace string
+	Name      string
+}
+
+// Load decodes the config and the state of the stream without namespace, see LoadStream
 func (i *Protocol) Load(stream string, config, state interface{}) error {
+	return i.LoadStream(StreamKey{Name: stream}, config, state)
+}
+
+// LoadStream decodes the config and the state of the stream. States provided without namespace are used
+// for streams with namespace if there is no state for the namespace
+func (i *Protocol) LoadStream(stream StreamKey, config, state interface{}) error {
 	if config == nil {
 	} else if len(i.config) > 0 {
-		if err := json.NewDecoder(bytes.NewReader(i.config)).Decode(config); err != nil {
+		if err := applyDefaults(reflect.ValueOf(config)); err != nil {
 			return err
+		} else if err := json.NewDecoder(bytes.NewReader(i.config)).Decode(config); err != nil {
+			return ConfigError(err)
 		}
 	} else if config != nil {
-		return fmt.Errorf("expected config")
+		return ConfigError(fmt.Errorf("expected config"))
 	}
 
+	v, ok := i.states[stream]
+	if !ok && stream.Namespace != "" {
+		v = i.states[StreamKey{Name: stream.Name}]
+	}
 	if state == nil {
 		return nil
-	} else if v := i.states[stream]; len(v) == 0 {
+	} else if len(v) == 0 {
 		return nil
 	} else if err := json.NewDecoder(bytes.NewReader(v)).Decode(state); err != nil {
 		return err
 	}
 	return nil
 }
+
+// Catalog decodes the configured catalog into v. Returns false if no catalog was provided
+func (i *Protocol) Catalog(v interface{}) (bool, error) {
+	if len(i.catalog) == 0 {
+		return false, nil
+	}
+	return true, json.NewDecoder(bytes.NewReader(i.catalog)).Decode(v)
+}
+
+// States returns the provided stream states by stream
+func (i *Protocol) States() map[StreamKey]json.RawMessage {
+	var out = make(map[StreamKey]json.RawMessage, len(i.states))
+	for k, v := range i.states {
+		out[k] = v
+	}
+	return out
+}
+
+// SharedState returns the shared state, ok is true if the state was provided in the global format
+func (i *Protocol) SharedState() (state []byte, ok bool) {
+	return i.sharedState, i.globalState
+}
+
+// ValidateConfig validates the config against the spec generated from the config type. Required fields,
+// types, enums and unknown keys are checked, all violations are returned as one error
+func (i *Protocol) ValidateConfig(config interface{}) error {
+	if config == nil {
+		return nil
+	}
+	s, err := configSchema(config)
+	if err != nil {
+		return err
+	}
+
+	var raw = i.config
+	if len(raw) == 0 {
+		raw = []byte("{}")
+	}
+	v, err := fastjson.ParseBytes(raw)
+	if err != nil {
+		return ConfigError(fmt.Errorf("invalid config: %w", err))
+	}
+
+	// keys are matched case-insensitive, like when the config is decoded
+	if errs := (validator{strict: true, foldCase: true}).validate(s, v); len(errs) > 0 {
+		return ConfigError(fmt.Errorf("invalid config: %w", errorList(errs)))
+	}
+	return nil
+}
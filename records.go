@@ -0,0 +1,148 @@
+package integ
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/valyala/fastjson"
+)
+
+// ValidationPolicy defines how records that do not match the json schema of the stream are handled
+type ValidationPolicy int
+
+const (
+	// ValidateNone emits the records without validation (default)
+	ValidateNone ValidationPolicy = iota
+	// ValidateDrop drops the invalid records, the number of dropped records is logged when the stream completes
+	ValidateDrop
+	// ValidateDeadLetter emits the invalid records with the errors to the stream <name>_dead_letter, or to
+	// the file set by DeadLetterFile. The records are dropped if the dead letter stream is not selected
+	ValidateDeadLetter
+	// ValidateFail fails the stream on the first invalid record
+	ValidateFail
+)
+
+// DeadLetter is a record that failed validation, emitted to the dead letter stream
+type DeadLetter struct {
+	Stream string      `json:"stream"`
+	Errors []string    `json:"errors"`
+	Record interface{} `json:"record"`
+}
+
+func deadLetterSchema(schema Schema) Schema {
+	return NonIncremental(schema.Name+"_dead_letter", DeadLetter{}).Namespace(schema.Namespace).Schema
+}
+
+// deadLetterSink receives the dead letters, the dead letter stream or a file
+type deadLetterSink interface {
+	EmitValues(values []*fastjson.Value) error
+}
+
+// deadLetterFile appends the dead letters to a file as json lines, the file is created on the first dead letter
+type deadLetterFile struct {
+	path string
+	f    *os.File
+	buf  []byte
+}
+
+func (d *deadLetterFile) EmitValues(values []*fastjson.Value) (err error) {
+	if d.f == nil {
+		if d.f, err = os.OpenFile(d.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err != nil {
+			return err
+		}
+	}
+	d.buf = d.buf[:0]
+	for _, v := range values {
+		d.buf = append(v.MarshalTo(d.buf), '\n')
+	}
+	_, err = d.f.Write(d.buf)
+	return err
+}
+
+func (d *deadLetterFile) Close() error {
+	if d == nil || d.f == nil {
+		return nil
+	}
+	return d.f.Close()
+}
+
+// recordValidator validates the emitted records against the json schema of the stream
+type recordValidator struct {
+	stream     string
+	policy     ValidationPolicy
+	schema     *jsonSchema
+	deadLetter deadLetterSink
+	target     string // the dead letter stream or file, for the report
+	arena      fastjson.Arena
+	invalid    int
+}
+
+func newRecordValidator(schema Schema, set streamSet) (*recordValidator, error) {
+	if schema.Validation == ValidateNone {
+		return nil, nil
+	}
+	s, err := newJsonSchema(schema.JsonSchema)
+	if err != nil {
+		return nil, err
+	}
+	v := &recordValidator{stream: schema.Name, policy: schema.Validation, schema: s}
+	if set.deadLetterFile != nil {
+		v.deadLetter, v.target = set.deadLetterFile, "file "+set.deadLetterFile.path
+	} else if set.deadLetter != nil {
+		v.deadLetter, v.target = set.deadLetter, "dead letter stream"
+	}
+	return v, nil
+}
+
+// filter validates the records, invalid records are handled by the policy and removed from the batch
+func (v *recordValidator) filter(values []*fastjson.Value) ([]*fastjson.Value, error) {
+	var out []*fastjson.Value // allocated on the first invalid record, values are returned otherwise
+	for i, value := range values {
+		errs := validator{}.validate(v.schema, value)
+		if len(errs) == 0 {
+			if out != nil {
+				out = append(out, value)
+			}
+			continue
+		} else if out == nil {
+			out = append(make([]*fastjson.Value, 0, len(values)), values[:i]...)
+		}
+		if err := v.reject(value, errs); err != nil {
+			return nil, err
+		}
+	}
+	if out == nil {
+		return values, nil
+	}
+	return out, nil
+}
+
+func (v *recordValidator) reject(value *fastjson.Value, errs []error) error {
+	v.invalid++
+	if v.policy == ValidateFail {
+		return fmt.Errorf("invalid record: %w", errorList(errs))
+	} else if v.policy != ValidateDeadLetter || v.deadLetter == nil {
+		return nil
+	}
+
+	v.arena.Reset()
+	arr := v.arena.NewArray()
+	for i, err := range errs {
+		arr.SetArrayItem(i, v.arena.NewString(err.Error()))
+	}
+	o := v.arena.NewObject()
+	o.Set("stream", v.arena.NewString(v.stream))
+	o.Set("errors", arr)
+	o.Set("record", value)
+	return v.deadLetter.EmitValues([]*fastjson.Value{o})
+}
+
+// report logs the number of invalid records
+func (v *recordValidator) report(sp StreamProto) error {
+	if v.invalid == 0 {
+		return nil
+	} else if v.policy == ValidateDeadLetter && v.deadLetter != nil {
+		return sp.EmitLog(fmt.Sprintf("%s: %d invalid records emitted to the %s", v.stream, v.invalid, v.target))
+	}
+	return sp.EmitLog(fmt.Sprintf("%s: %d invalid records dropped", v.stream, v.invalid))
+}
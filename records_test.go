@@ -0,0 +1,126 @@
+package integ_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ajzo90/go-integ"
+	"github.com/valyala/fastjson"
+)
+
+func TestValidateRecords(t *testing.T) {
+	type order struct {
+		Id    int    `json:"id"`
+		Email string `json:"email"`
+	}
+	emit := integ.GeneralRunnerFunc(func(ctx integ.GeneralContext) error {
+		for _, v := range []map[string]interface{}{{"id": 1, "email": "a"}, {"id": "2", "email": "b"}, {"id": 3}} {
+			if err := ctx.EmitValue(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	src := integ.NewSource(struct{}{}).
+		GeneralStream(integ.NonIncremental("orders", order{}).ValidateRecords(integ.ValidateDeadLetter), emit).
+		GeneralStream(integ.NonIncremental("dropped", order{}).ValidateRecords(integ.ValidateDrop), emit)
+
+	out := handle(t, src, integ.CmdRead)
+	for _, expected := range []string{
+		`"data":{"stream":"orders","errors":["id: expected integer, got string"],"record":{"email":"b","id":"2"}}`,
+		`"data":{"stream":"orders","errors":["email: missing required field"],"record":{"id":3}}`,
+		`"log":"orders: 2 invalid records emitted to the dead letter stream"`,
+		`"log":"dropped: 2 invalid records dropped"`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %s: %s", expected, out)
+		}
+	}
+	if strings.Count(out, `"data":{"email":"a","id":1}`) != 2 || strings.Count(out, `"type":"RECORD"`) != 4 {
+		t.Errorf("expected the valid records: %s", out)
+	}
+
+	src = integ.NewSource(struct{}{}).
+		GeneralStream(integ.NonIncremental("orders", order{}).ValidateRecords(integ.ValidateFail), emit)
+	if out := handle(t, src, integ.CmdRead); !strings.Contains(out, `"log":"invalid record: id: expected integer, got string"`) {
+		t.Errorf("expected the stream to fail: %s", out)
+	}
+
+	file := filepath.Join(t.TempDir(), "dead.jsonl")
+	src = integ.NewSource(struct{}{}).
+		GeneralStream(integ.NonIncremental("orders", order{}).DeadLetterFile(file), emit)
+	out = handle(t, src, integ.CmdRead)
+	if strings.Contains(out, "orders_dead_letter") || strings.Count(out, `"type":"RECORD"`) != 1 {
+		t.Errorf("expected only the valid record in the output: %s", out)
+	} else if !strings.Contains(out, `"log":"orders: 2 invalid records emitted to the file `+file+`"`) {
+		t.Errorf("expected the dead letter file in the report: %s", out)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `{"stream":"orders","errors":["id: expected integer, got string"],"record":{"email":"b","id":"2"}}
+{"stream":"orders","errors":["email: missing required field"],"record":{"id":3}}
+`
+	if string(b) != expected {
+		t.Errorf("expected the dead letters in the file\n%s, got\n%s", expected, b)
+	}
+}
+
+func TestCoerce(t *testing.T) {
+	type order struct {
+		OrderNo  float64   `json:"order_no"`
+		Id       int       `json:"id"`
+		Paid     bool      `json:"paid"`
+		Created  time.Time `json:"created"`
+		Tags     []string  `json:"tags"`
+		Comment  string    `json:"comment"`
+		Shipping *float64  `json:"shipping"`
+	}
+	src := integ.NewSource(struct{}{}).
+		GeneralStream(integ.NonIncremental("orders", order{}).Coerce().ValidateRecords(integ.ValidateFail), integ.GeneralRunnerFunc(func(ctx integ.GeneralContext) error {
+			return ctx.EmitValue(map[string]interface{}{
+				"order_no": "1001.5", "id": " 7", "paid": "true", "created": "2022-04-07T12:39:06+02:00",
+				"tags": "vip", "comment": "12", "shipping": nil,
+			})
+		}))
+
+	out := handle(t, src, integ.CmdRead)
+	const expected = `"data":{"comment":"12","created":"2022-04-07T10:39:06Z","id":7,"order_no":1001.5,"paid":true,"shipping":null,"tags":["vip"]}`
+	if !strings.Contains(out, expected) {
+		t.Errorf("expected %s: %s", expected, out)
+	} else if !strings.Contains(out, `"log":"orders: 5 values coerced (array: 1, boolean: 1, date-time: 1, number: 2)"`) {
+		t.Errorf("expected coercion stats: %s", out)
+	}
+}
+
+func TestDetectDrift(t *testing.T) {
+	type order struct {
+		Id    int    `json:"id"`
+		Email string `json:"email"`
+		Lines []struct {
+			Sku string `json:"sku"`
+		} `json:"lines"`
+	}
+	emit := integ.GeneralRunnerFunc(func(ctx integ.GeneralContext) error {
+		return ctx.EmitValues(fastjson.MustParse(`[{"id":1,"lines":[{"sku":1}],"note":""},{"id":"2","lines":[{"sku":"a","qty":1}]}]`).GetArray())
+	})
+
+	src := integ.NewSource(struct{}{}).GeneralStream(integ.NonIncremental("orders", order{}).DetectDrift(5), emit)
+	out := handle(t, src, integ.CmdRead)
+	const expected = `"log":"orders: schema drift in 2 records: new properties [lines[].qty, note]; missing properties [email]; type changes [id (expected integer, got string), lines[].sku (expected string, got integer)]"`
+	if !strings.Contains(out, expected) {
+		t.Errorf("expected %s: %s", expected, out)
+	} else if strings.Contains(out, "exceeds the threshold") {
+		t.Errorf("expected drift below the threshold: %s", out)
+	}
+
+	src = integ.NewSource(struct{}{}).GeneralStream(integ.NonIncremental("orders", order{}).DetectDrift(1), emit)
+	if out := handle(t, src, integ.CmdRead); !strings.Contains(out, `"log":"orders: schema drift exceeds the threshold, 5 changes (max 1)"`) {
+		t.Errorf("expected the stream to fail: %s", out)
+	}
+}
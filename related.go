@@ -0,0 +1,225 @@
+package integ
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/valyala/fastjson"
+	"golang.org/x/sync/errgroup"
+)
+
+// streamSet is the stream protos of a runner, the stream, the dead letter stream (or file) and the related (child) streams
+type streamSet struct {
+	sp             StreamProto
+	deadLetter     StreamProto
+	deadLetterFile *deadLetterFile
+	related        map[string]StreamProto // nil if the related stream is not selected
+}
+
+// openStreams opens the stream and the streams derived from the schema. ok is false if the stream is not selected
+func openStreams(proto Proto, schema Schema) (set streamSet, ok bool, err error) {
+	if set.sp, err = proto.Open(schema); err != nil || set.sp == nil {
+		return set, false, err
+	}
+	if schema.Validation == ValidateDeadLetter && schema.DeadLetterFile != "" {
+		set.deadLetterFile = &deadLetterFile{path: schema.DeadLetterFile}
+	} else if schema.Validation == ValidateDeadLetter {
+		if set.deadLetter, err = proto.Open(deadLetterSchema(schema)); err != nil {
+			return set, false, err
+		}
+	}
+	set.related = map[string]StreamProto{}
+	for _, child := range schema.Related {
+		if set.related[child.Name], err = proto.Open(child); err != nil {
+			return set, false, err
+		}
+	}
+	return set, true, nil
+}
+
+// emitStatus reports the status of the streams, if supported by the proto
+func (s streamSet) emitStatus(status StreamStatus) error {
+	var names []string
+	for name := range s.related {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sps = []StreamProto{s.sp, s.deadLetter}
+	for _, name := range names {
+		sps = append(sps, s.related[name])
+	}
+	for _, sp := range sps {
+		if t, ok := sp.(StreamTracer); ok {
+			if err := t.EmitStreamStatus(status); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s streamSet) flush() error {
+	if err := s.sp.Flush(); err != nil {
+		return err
+	} else if s.deadLetter != nil {
+		if err := s.deadLetter.Flush(); err != nil {
+			return err
+		}
+	}
+	for _, sp := range s.related {
+		if sp != nil {
+			if err := sp.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// relatedCtx is the context of a related stream, safe for concurrent use
+type relatedCtx struct {
+	mtx sync.Mutex
+	c   *baseRunContext
+}
+
+var _ GeneralContext = &relatedCtx{}
+
+func (r *relatedCtx) Load(config, state interface{}) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.c.Load(config, state)
+}
+
+func (r *relatedCtx) Schema() Schema {
+	return r.c.Schema()
+}
+
+func (r *relatedCtx) Configured() ConfiguredStream {
+	return r.c.Configured()
+}
+
+func (r *relatedCtx) EmitState(v interface{}) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.c.EmitState(v)
+}
+
+func (r *relatedCtx) EmitLog(v any) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.c.EmitLog(v)
+}
+
+func (r *relatedCtx) EmitEstimate(rows, bytes int64) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.c.EmitEstimate(rows, bytes)
+}
+
+func (r *relatedCtx) EmitValues(v []*fastjson.Value) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.c.EmitValues(v)
+}
+
+func (r *relatedCtx) EmitValue(v any) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.c.EmitValue(v)
+}
+
+func (r *relatedCtx) EmitRelated(typ Schema, v any) error {
+	return r.c.EmitRelated(typ, v)
+}
+
+func (r *relatedCtx) Related(typ Schema) (GeneralContext, error) {
+	return r.c.Related(typ)
+}
+
+func (r *relatedCtx) FanOut(n, concurrency int, fn func(i int) error) error {
+	return r.c.FanOut(n, concurrency, fn)
+}
+
+// complete emits the registered cursor of the related stream and reports the stats
+func (r *relatedCtx) complete() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if err := r.c.checkpoint(0, true); err != nil {
+		return err
+	}
+	return r.c.report()
+}
+
+// setupRelated creates the contexts of the related streams, only one level of related streams is supported
+func (r *baseRunContext) setupRelated(related map[string]StreamProto) error {
+	r.related = map[string]*relatedCtx{}
+	for _, child := range r.schema.Related {
+		sp := related[child.Name]
+		if sp == nil {
+			r.related[child.Name] = nil // not selected
+			continue
+		}
+		c := makeBaseRunCtx(r.ctx, child, sp)
+		c.noRecover = r.noRecover
+		if err := c.setup(streamSet{sp: sp}); err != nil {
+			return err
+		}
+		r.related[child.Name] = &relatedCtx{c: &c}
+	}
+	return nil
+}
+
+func (r *baseRunContext) Related(typ Schema) (GeneralContext, error) {
+	c, ok := r.related[typ.Name]
+	if !ok {
+		return nil, fmt.Errorf("stream %s: related stream %s is not declared", r.schema.Name, typ.Name)
+	} else if c == nil {
+		return nil, ErrSkipStream
+	}
+	return c, nil
+}
+
+func (r *baseRunContext) EmitRelated(typ Schema, v any) error {
+	c, err := r.Related(typ)
+	if err == ErrSkipStream {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return c.EmitValue(v)
+}
+
+func (r *baseRunContext) FanOut(n, concurrency int, fn func(i int) error) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	wg, ctx := errgroup.WithContext(r.ctx)
+	var t = make(throttler, concurrency)
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		i := i // copy
+		t <- struct{}{}
+		wg.Go(func() (err error) {
+			defer func() { <-t }()
+			defer recoverPanic(!r.noRecover, &err)
+			return fn(i)
+		})
+	}
+	if err := wg.Wait(); err != nil {
+		return err
+	}
+	return r.ctx.Err()
+}
+
+// completeRelated completes the related streams
+func (r *baseRunContext) completeRelated() error {
+	for _, child := range r.schema.Related {
+		if c := r.related[child.Name]; c != nil {
+			if err := c.complete(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package integ_test
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ajzo90/go-integ"
+)
+
+func TestEmitRelated(t *testing.T) {
+	type order struct {
+		Id int `json:"id"`
+	}
+	type lineItem struct {
+		OrderId int    `json:"order_id"`
+		Sku     string `json:"sku"`
+	}
+	lineItems := integ.NonIncremental("line_items", lineItem{})
+	orders := integ.NonIncremental("orders", order{}).Related(lineItems)
+
+	var running, maxRunning int32
+	src := integ.NewSource(struct{}{}).
+		GeneralStream(orders, integ.GeneralRunnerFunc(func(ctx integ.GeneralContext) error {
+			var ids = []int{1, 2, 3, 4}
+			for _, id := range ids {
+				if err := ctx.EmitValue(order{Id: id}); err != nil {
+					return err
+				}
+			}
+
+			// one child request per order
+			err := ctx.FanOut(len(ids), 2, func(i int) error {
+				n := atomic.AddInt32(&running, 1)
+				for max := atomic.LoadInt32(&maxRunning); n > max && !atomic.CompareAndSwapInt32(&maxRunning, max, n); {
+					max = atomic.LoadInt32(&maxRunning)
+				}
+				defer atomic.AddInt32(&running, -1)
+				return ctx.EmitRelated(lineItems.Schema, lineItem{OrderId: ids[i], Sku: fmt.Sprint("sku", i)})
+			})
+			if err != nil {
+				return err
+			}
+
+			child, err := ctx.Related(lineItems.Schema)
+			if err != nil {
+				return err
+			}
+			return child.EmitState(map[string]int{"orders": len(ids)})
+		}))
+
+	out := handle(t, src, integ.CmdRead)
+	if strings.Count(out, `"stream":"line_items"`) != 4 || strings.Count(out, `"stream":"orders"`) != 4 {
+		t.Errorf("expected 4 orders and 4 line items: %s", out)
+	} else if !strings.Contains(out, `"stream_descriptor":{"name":"line_items"},"stream_state":{"orders":4}`) {
+		t.Errorf("expected line items state: %s", out)
+	} else if maxRunning > 2 {
+		t.Errorf("expected at most 2 concurrent requests, got %d", maxRunning)
+	}
+
+	if out := handle(t, src, integ.CmdDiscover); !strings.Contains(out, `"name":"line_items"`) {
+		t.Errorf("expected related stream in the catalog: %s", out)
+	}
+}
@@ -1,6 +1,14 @@
 package integ
 
-import "github.com/ajzo90/go-jsonschema-generator"
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ajzo90/go-jsonschema-generator"
+)
 
 type Schema struct {
 	Incremental        bool
@@ -14,20 +22,78 @@ type Schema struct {
 	GoType             interface{}
 	JsonSchema         *jsonschema.Document
 	Namespace          string
+	Validation         ValidationPolicy
+	DeadLetterFile     string
+	CoerceTypes        bool
+	DriftDetection     bool
+	DriftThreshold     int
+	Related            []Schema
 }
 
+// Validate checks the schema definition
 func (s Schema) Validate() error {
-	return nil
+	var errs errorList
+	if s.Name == "" {
+		errs = append(errs, fmt.Errorf("stream without name"))
+	}
+
+	js, err := newJsonSchema(s.JsonSchema)
+	if err != nil {
+		return err
+	}
+	for _, c := range []struct {
+		name string
+		keys []FieldDef
+	}{{"primary key", s.PrimaryKey}, {"cursor", s.OrderByKey}, {"iterate by key", s.IterateByKey}} {
+		for _, f := range c.keys {
+			if !js.hasPath(f.Path) {
+				errs = append(errs, fmt.Errorf("stream %s: %s field %v does not exist", s.Name, c.name, f.Path))
+			}
+		}
+	}
+
+	tags := taggedFields(s.GoType)
+	var invalid []string
+	for tag := range tags {
+		if tag != "pk" && tag != "cursor" && tag != "iterate" {
+			invalid = append(invalid, tag)
+		}
+	}
+	sort.Strings(invalid)
+	for _, tag := range invalid {
+		errs = append(errs, fmt.Errorf("stream %s: invalid integ tag \"%s\" on %v", s.Name, tag, paths(tags[tag])))
+	}
+	for _, c := range []struct {
+		tag  string
+		name string
+		keys []FieldDef
+	}{{"pk", "primary key", s.PrimaryKey}, {"cursor", "cursor", s.OrderByKey}, {"iterate", "iterate by key", s.IterateByKey}} {
+		if tagged, ok := tags[c.tag]; ok && !equalPaths(tagged, c.keys) {
+			errs = append(errs, fmt.Errorf("stream %s: %s %v conflicts with the integ:\"%s\" tags %v", s.Name, c.name, paths(c.keys), c.tag, paths(tagged)))
+		}
+	}
+	return errs.err()
 }
 
 type SchemaBuilder struct {
 	Schema
 }
 
+// NonIncremental defines a full refresh stream of records of type typ. The keys are read from the struct
+// tags integ:"pk", integ:"cursor" and integ:"iterate" (comma separated), including nested structs
 func NonIncremental(name string, typ interface{}) SchemaBuilder {
-	return SchemaBuilder{Schema: Schema{Name: name, GoType: typ, JsonSchema: jsonschema.New(typ)}}
+	tags := taggedFields(typ)
+	return SchemaBuilder{Schema: Schema{
+		Name:         name,
+		GoType:       typ,
+		JsonSchema:   jsonschema.New(typ),
+		PrimaryKey:   tags["pk"],
+		OrderByKey:   tags["cursor"],
+		IterateByKey: tags["iterate"],
+	}}
 }
 
+// Incremental defines an incremental stream, see NonIncremental
 func Incremental(name string, typ interface{}) SchemaBuilder {
 	v := NonIncremental(name, typ)
 	v.Incremental = true
@@ -39,6 +105,44 @@ func (s SchemaBuilder) Namespace(namespace string) SchemaBuilder {
 	return s
 }
 
+// ValidateRecords validates the records against the json schema, invalid records are handled by the policy
+func (s SchemaBuilder) ValidateRecords(policy ValidationPolicy) SchemaBuilder {
+	s.Validation = policy
+	return s
+}
+
+// DeadLetterFile validates the records with ValidateDeadLetter, the invalid records are appended to the file
+// at path (json lines) instead of the dead letter stream
+func (s SchemaBuilder) DeadLetterFile(path string) SchemaBuilder {
+	s.Validation = ValidateDeadLetter
+	s.Schema.DeadLetterFile = path
+	return s
+}
+
+// Coerce converts the record values to the types in the json schema where possible (numeric and
+// boolean strings, date-times to RFC3339 UTC, scalars to arrays). Coercion happens before validation
+func (s SchemaBuilder) Coerce() SchemaBuilder {
+	s.CoerceTypes = true
+	return s
+}
+
+// DetectDrift compares the emitted records with the json schema and logs new properties, properties that are
+// always missing and type changes when the stream completes. The stream fails if the number of changes
+// exceeds maxChanges, a negative value only logs the drift
+func (s SchemaBuilder) DetectDrift(maxChanges int) SchemaBuilder {
+	s.DriftDetection, s.DriftThreshold = true, maxChanges
+	return s
+}
+
+// Related declares child streams, the runner emits their records with EmitRelated. The related streams
+// are part of the catalog, with their own state
+func (s SchemaBuilder) Related(children ...SchemaBuilder) SchemaBuilder {
+	for _, c := range children {
+		s.Schema.Related = append(s.Schema.Related, c.Schema)
+	}
+	return s
+}
+
 func (s SchemaBuilder) Primary(keys ...FieldDef) SchemaBuilder {
 	s.PrimaryKey = keys
 	return s
@@ -69,8 +173,126 @@ func (s SchemaBuilder) CustomIterateBy() SchemaBuilder {
 	return s
 }
 
+// FieldKeys returns the names of the leaf fields, sorted. Nested fields are joined with a dot (product.id),
+// the sub-field syntax of most field selection apis, see FieldPaths
 func (s Schema) FieldKeys() []string {
-	return Keys(jsonschema.New(s.GoType))
+	var out []string
+	for _, p := range s.FieldPaths() {
+		out = append(out, strings.Join(p, "."))
+	}
+	return out
+}
+
+// FieldPaths returns the paths of the leaf fields, sorted. Nested objects (and arrays of objects) are
+// expanded, {"product":{"id":1}} gives [["product", "id"]]
+func (s Schema) FieldPaths() [][]string {
+	js, err := newJsonSchema(jsonschema.New(s.GoType))
+	if err != nil {
+		return nil
+	}
+	return js.paths(nil, nil)
+}
+
+func (s *jsonSchema) paths(prefix []string, out [][]string) [][]string {
+	for s.Items != nil {
+		s = s.Items
+	}
+	if _, isMap := s.Properties[".*"]; len(s.Properties) == 0 || isMap {
+		if len(prefix) > 0 {
+			out = append(out, prefix)
+		}
+		return out
+	}
+
+	var keys []string
+	for k := range s.Properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		out = s.Properties[k].paths(append(prefix[:len(prefix):len(prefix)], k), out)
+	}
+	return out
+}
+
+// SyncMode defines how a stream is synced
+type SyncMode string
+
+const (
+	SyncModeFullRefresh SyncMode = "full_refresh"
+	SyncModeIncremental SyncMode = "incremental"
+)
+
+// ConfiguredStream is the sync configuration selected for a stream
+type ConfiguredStream struct {
+	SyncMode            SyncMode
+	CursorField         []string
+	DestinationSyncMode string
+	PrimaryKey          [][]string
+}
+
+// Configured returns the default sync configuration, used when no catalog is provided
+func (s Schema) Configured() ConfiguredStream {
+	c := ConfiguredStream{SyncMode: SyncModeFullRefresh, PrimaryKey: paths(s.PrimaryKey)}
+	if s.Incremental {
+		c.SyncMode = SyncModeIncremental
+	}
+	if len(s.OrderByKey) > 0 {
+		c.CursorField = s.OrderByKey[0].Path
+	}
+	return c
+}
+
+// taggedFields returns the fields by integ tag, in field order
+func taggedFields(typ interface{}) map[string][]FieldDef {
+	var out = map[string][]FieldDef{}
+	if typ != nil {
+		readTags(reflect.TypeOf(typ), nil, out)
+	}
+	return out
+}
+
+func readTags(t reflect.Type, prefix []string, out map[string][]FieldDef) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := jsonName(field)
+		if name == "-" {
+			continue
+		} else if field.Anonymous {
+			readTags(field.Type, prefix, out)
+			continue
+		}
+
+		path := append(prefix[:len(prefix):len(prefix)], name)
+		if tag := field.Tag.Get("integ"); tag != "" {
+			for _, k := range strings.Split(tag, ",") {
+				out[k] = append(out[k], Field(path...))
+			}
+		}
+		readTags(field.Type, path, out)
+	}
+}
+
+func equalPaths(a, b []FieldDef) bool {
+	return reflect.DeepEqual(paths(a), paths(b))
+}
+
+func paths(fields []FieldDef) [][]string {
+	if len(fields) == 0 {
+		return nil
+	}
+	var out = make([][]string, len(fields))
+	for i, f := range fields {
+		out[i] = f.Path
+	}
+	return out
 }
 
 // SupportedSyncModes      []SyncMode `json:"supported_sync_modes,omitempty"`
@@ -0,0 +1,55 @@
+package integ_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ajzo90/go-integ"
+)
+
+func TestFieldPaths(t *testing.T) {
+	type product struct {
+		Id   int               `json:"id"`
+		Tags map[string]string `json:"tags"`
+	}
+	schema := integ.NonIncremental("items", struct {
+		PartNo  string    `json:"part_no"`
+		Product product   `json:"product"`
+		Related []product `json:"related"`
+	}{}).Schema
+
+	expected := [][]string{{"part_no"}, {"product", "id"}, {"product", "tags"}, {"related", "id"}, {"related", "tags"}}
+	if paths := schema.FieldPaths(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v got %v", expected, paths)
+	}
+	if keys := schema.FieldKeys(); !reflect.DeepEqual(keys, []string{"part_no", "product.id", "product.tags", "related.id", "related.tags"}) {
+		t.Errorf("unexpected field keys %v", keys)
+	}
+}
+
+func TestKeyTags(t *testing.T) {
+	type product struct {
+		Id int `json:"id" integ:"pk"`
+	}
+	type item struct {
+		PartNo  string    `json:"part_no" integ:"pk"`
+		Updated time.Time `json:"updated" integ:"cursor,iterate"`
+		Product product   `json:"product"`
+	}
+
+	s := integ.Incremental("items", item{}).Schema
+	if pk := s.Configured().PrimaryKey; !reflect.DeepEqual(pk, [][]string{{"part_no"}, {"product", "id"}}) {
+		t.Errorf("unexpected primary key %v", pk)
+	} else if len(s.OrderByKey) != 1 || len(s.IterateByKey) != 1 || s.OrderByKey[0].Path[0] != "updated" {
+		t.Errorf("unexpected cursor %v %v", s.OrderByKey, s.IterateByKey)
+	} else if err := s.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	s = integ.Incremental("items", item{}).Primary(integ.Field("part_no")).Schema
+	const expected = `stream items: primary key [[part_no]] conflicts with the integ:"pk" tags [[part_no] [product id]]`
+	if err := s.Validate(); err == nil || err.Error() != expected {
+		t.Errorf("expected %s, got %v", expected, err)
+	}
+}
@@ -2,9 +2,11 @@ package integ
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 
 	"github.com/ajzo90/go-jsonschema-generator"
 	"golang.org/x/sync/errgroup"
@@ -21,18 +23,32 @@ type sourceDef struct {
 	docs             []string
 	version          string
 	concurrency      int
+	interleaved      bool
+	noRecover        bool
 }
 
 func (r *sourceDef) Handle(ctx context.Context, cmd Command, writer io.Writer, rd io.Reader, protos Protos) error {
-	proto, err := Open(rd, writer, cmd, protos)
+	// a broken source definition fails before any command is handled
+	if err := r.Validate(); err != nil {
+		return fmt.Errorf("invalid source: %w", err)
+	}
+	i, err := parseProtocol(rd, writer, cmd)
+	if err != nil {
+		return err
+	}
+	proto, err := i.open(protos)
 	if err != nil {
 		return err
 	}
 
-	err = r.handleCmd(ctx, proto, cmd)
+	if cmd != CmdCheck && cmd != CmdRead {
+		err = r.handleCmd(ctx, proto, cmd)
+	} else if err = i.ValidateConfig(r.config); err == nil {
+		err = r.handleCmd(ctx, proto, cmd)
+	} else if cmd == CmdCheck {
+		err = proto.EmitStatus(err)
+	}
 	closeErr := proto.Close()
-
-	proto.Close()
 	if err != nil {
 		return err
 	} else {
@@ -60,7 +76,7 @@ func (r *sourceDef) handleCmd(ctx context.Context, proto Proto, cmd Command) err
 }
 
 func NewSource(config interface{}) *sourceDef {
-	return &sourceDef{config: config, concurrency: 1}
+	return &sourceDef{config: config}
 }
 
 func (r *sourceDef) Documentation(links ...string) *sourceDef {
@@ -78,25 +94,67 @@ func (r *sourceDef) Notes(links ...string) *sourceDef {
 	return r
 }
 
-// the streams are interleaved
+// Interleaved runs the streams in parallel, the records of the streams are interleaved in the output.
+// The number of streams running at the same time is limited by Concurrency (unlimited by default).
+// The streams run one at a time in the order they are defined otherwise, and always in discover.
 func (r *sourceDef) Interleaved() *sourceDef {
+	r.interleaved = true
+	return r
+}
+
+// Concurrency limits the number of streams running at the same time, n > 1 implies Interleaved
+func (r *sourceDef) Concurrency(n int) *sourceDef {
+	r.concurrency = n
+	r.interleaved = r.interleaved || n > 1
+	return r
+}
+
+// RecoverPanics converts panics of the runners into stream errors, enabled by default. The stream of a panicking
+// runner fails, the other streams complete and Handle returns the error. Disable to crash with the panic (debugging)
+func (r *sourceDef) RecoverPanics(enabled bool) *sourceDef {
+	r.noRecover = !enabled
 	return r
 }
 
+// runManual runs the manual runner, panics are converted into errors unless disabled
+func (r *sourceDef) runManual(c *manualCtx) (err error) {
+	defer recoverPanic(!r.noRecover, &err)
+	c.noRecover = r.noRecover
+	return r.manualRunner.Run(c)
+}
+
 func (r *sourceDef) HttpRunner(runner HttpRunner) *sourceDef {
 	r.sharedHttpRunner = runner
 	return r
 }
 
+// GeneralStream adds a stream that is not bound to a specific kind of source (grpc, sdk etc)
 func (r *sourceDef) GeneralStream(schema SchemaBuilder, runner ...GeneralRunner) *sourceDef {
+	r.incremental = r.incremental || schema.Incremental
+	var fn GeneralRunner
+	if len(runner) == 1 {
+		fn = runner[0]
+	}
+	r.runners = append(r.runners, runnerTyp{schema: schema.Schema, generalRunner: fn})
 	return r
 }
 
+// FsStream adds a file based stream, FileRunner is used if no runner is provided
 func (r *sourceDef) FsStream(schema SchemaBuilder, runner ...FsRunner) *sourceDef {
+	r.incremental = r.incremental || schema.Incremental
+	var fn FsRunner = FileRunner
+	if len(runner) == 1 {
+		fn = runner[0]
+	}
+	r.runners = append(r.runners, runnerTyp{schema: schema.Schema, fsRunner: fn})
 	return r
 }
 
-func (r *sourceDef) DbStream(schema SchemaBuilder, runner ...DbRunner) *sourceDef {
+// DbStream adds a database stream, the runner is expected to call DbContext.EmitTable. There is no shared
+// runner, the runner is required
+func (r *sourceDef) DbStream(schema SchemaBuilder, runner DbRunner) *sourceDef {
+	r.incremental = r.incremental || schema.Incremental
+	r.runners = append(r.runners, runnerTyp{schema: schema.Schema, dbRunner: runner})
 	return r
 }
 
@@ -117,28 +175,65 @@ func (r *sourceDef) HttpStream(schema SchemaBuilder, runner ...HttpRunner) *sour
 	return r
 }
 
+// Spec emits the schema of the config, the same schema ValidateConfig validates against (with enums and defaults)
 func (r *sourceDef) Spec(ctx context.Context, proto Proto) error {
 	return proto.EmitSpec(ConnectorSpecification{
 		DocumentationURL:        strings.Join(r.docs, ","),
 		SupportsIncremental:     r.incremental, // why is this important to share?
 		ConnectionSpecification: jsonschema.New(r.config),
+		config:                  r.config,
 	})
 }
 
+// Check probes every stream and logs the result per stream. The streams, and the manual runner, run until
+// the first records are emitted. A single status is emitted, failed if any stream failed.
 func (r *sourceDef) Check(ctx context.Context, proto Proto) error {
+	var failed []string
+	var checked int
+
+	report := func(sp StreamProto, name string, err error) error {
+		checked++
+		if err == nil {
+			return sp.EmitLog(fmt.Sprintf("check %s: ok", name))
+		}
+		failed = append(failed, fmt.Sprintf("%s: %s", name, err.Error()))
+		return sp.EmitLog(fmt.Sprintf("check %s failed: %s", name, err.Error()))
+	}
+
 	for _, runner := range r.runners {
-		stPr, err := proto.Open(runner.schema)
+		runner.noRecover = r.noRecover
+		sp, err := proto.Open(runner.schema)
 		if err != nil {
 			return err
+		} else if sp == nil {
+			continue
+		} else if err := report(sp, runner.schema.Name, checkStream(ctx, runner, sp)); err != nil {
+			return err
 		}
-		runCtx := newHTTPRunCtx(ctx, runner.schema, stPr)
-		if err := runner.httpRunner.Run(&validatorLoader{httpRunContext: *runCtx}); err == validatorOK {
-			return proto.EmitStatus(nil)
-		} else if err != nil {
-			return proto.EmitStatus(fmt.Errorf("validation failed: %s", err.Error()))
+	}
+
+	// the manual runner is reported as one, its error can't be attributed to a stream
+	if r.manualRunner != nil {
+		c := &manualCtx{ctx: ctx, p: proto, check: true}
+		err := r.runManual(c)
+		if errors.Is(err, validatorOK) {
+			err = nil
+		}
+		if len(c.streams) > 0 {
+			if err := report(c.streams[0].StreamProto, "manual runner", err); err != nil {
+				return err
+			}
+		} else if checked++; err != nil {
+			failed = append(failed, fmt.Sprintf("manual runner: %s", err.Error()))
 		}
 	}
-	return fmt.Errorf("validation failed: unexpected error")
+
+	if len(failed) > 0 {
+		return proto.EmitStatus(fmt.Errorf("validation failed: %s", strings.Join(failed, "; ")))
+	} else if checked == 0 {
+		return proto.EmitStatus(fmt.Errorf("validation failed: no streams to check"))
+	}
+	return proto.EmitStatus(nil)
 }
 
 // Emit scehmas by calling run without sync
@@ -162,34 +257,124 @@ func (t *throttler) Wrap(f func() error) func() error {
 }
 
 func (r *sourceDef) Run(ctx context.Context, proto Proto, sync bool) error {
-	wg, ctx := errgroup.WithContext(ctx)
-
-	var t = make(throttler, r.concurrency)
+	// stream failures (panics) fail the sync when the other streams complete
+	var failures failureList
 
+	var streams []func(ctx context.Context) error
 	for _, runner := range r.runners {
 		runner := runner // copy
-		wg.Go(t.Wrap(func() error {
-			return run(ctx, proto, runner, sync)
-		}))
+		runner.noRecover = r.noRecover
+		streams = append(streams, func(ctx context.Context) error {
+			return failures.collect(run(ctx, proto, runner, sync))
+		})
 	}
 
 	if r.manualRunner != nil {
-		c := &manualCtx{p: proto}
-		wg.Go(t.Wrap(func() error {
-			if err := r.manualRunner.Run(c); err != nil {
+		streams = append(streams, func(ctx context.Context) error {
+			c := &manualCtx{ctx: ctx, p: proto}
+			if err := r.runManual(c); errors.As(err, new(panicErr)) {
+				return failures.collect(&streamFailure{err: fmt.Errorf("manual runner: %w", err)})
+			} else if err != nil {
 				return err
 			}
 			return c.Close()
+		})
+	}
+
+	// discover runs in definition order, the catalog is stable
+	if !r.interleaved || !sync {
+		for _, stream := range streams {
+			if err := stream(ctx); err != nil {
+				return err
+			}
+		}
+		return failures.errs.err()
+	}
+
+	var concurrency = r.concurrency
+	if concurrency <= 0 {
+		concurrency = len(streams)
+	}
+
+	wg, ctx := errgroup.WithContext(ctx)
+	var t = make(throttler, concurrency)
+	for _, stream := range streams {
+		stream := stream // copy
+		wg.Go(t.Wrap(func() error {
+			return stream(ctx)
 		}))
 	}
-	return wg.Wait()
+	if err := wg.Wait(); err != nil {
+		return err
+	}
+	return failures.errs.err()
+}
+
+// failureList collects the stream failures of a sync, safe for concurrent use
+type failureList struct {
+	mtx  sync.Mutex
+	errs errorList
 }
 
+// collect records err if it is a stream failure, other errors are returned
+func (l *failureList) collect(err error) error {
+	var f *streamFailure
+	if !errors.As(err, &f) {
+		return err
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.errs = append(l.errs, f)
+	return nil
+}
+
+// Validate checks the source definition: the config spec, duplicate stream names, missing runners,
+// incremental streams without cursor and the stream schemas (including related streams). All problems are returned as one error
 func (r *sourceDef) Validate() error {
+	var errs errorList
+	if err := validateConfigSpec(r.config); err != nil {
+		errs = append(errs, err)
+	}
+
+	var seen = map[string]bool{}
+	unique := func(schema Schema) {
+		if key := schema.Namespace + "." + schema.Name; seen[key] {
+			errs = append(errs, fmt.Errorf("stream %s: duplicate stream name", schema.Name))
+		} else {
+			seen[key] = true
+		}
+	}
+	addErr := func(err error) {
+		if list, ok := err.(errorList); ok {
+			errs = append(errs, list...)
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	for _, runner := range r.runners {
-		if err := runner.schema.Validate(); err != nil {
-			return err
+		schema := runner.schema
+		unique(schema)
+		for _, child := range schema.Related {
+			unique(child)
+			addErr(child.Validate())
+			if len(child.Related) > 0 {
+				errs = append(errs, fmt.Errorf("stream %s: nested related streams are not supported", child.Name))
+			}
+		}
+
+		if runner.httpRunner == nil && runner.fsRunner == nil && runner.dbRunner == nil && runner.generalRunner == nil {
+			errs = append(errs, fmt.Errorf("stream %s: no runner, provide a runner or set the shared HttpRunner before the stream", schema.Name))
+		}
+		// the state of file streams is the modification time
+		if schema.Incremental && len(schema.OrderByKey) == 0 && !schema.CustomOrderByKey && runner.fsRunner == nil {
+			errs = append(errs, fmt.Errorf("stream %s: incremental stream without cursor", schema.Name))
+		}
+
+		addErr(schema.Validate())
+		if v, ok := runner.httpRunner.(interface{ validateSchema(Schema) error }); ok {
+			addErr(v.validateSchema(schema))
 		}
 	}
-	return nil
+	return errs.err()
 }
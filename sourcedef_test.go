@@ -0,0 +1,269 @@
+package integ_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ajzo90/go-integ"
+	"github.com/ajzo90/go-integ/pkg/airbyte"
+	"github.com/valyala/fastjson"
+)
+
+func emitStream(wg *sync.WaitGroup) integ.GeneralRunnerFunc {
+	return func(ctx integ.GeneralContext) error {
+		if wg != nil {
+			// all streams must be running at the same time to pass
+			wg.Done()
+			wg.Wait()
+		}
+		return ctx.EmitValue(map[string]string{"name": ctx.Schema().Name})
+	}
+}
+
+func TestRunOrder(t *testing.T) {
+	src := integ.NewSource(struct{}{})
+	for _, name := range []string{"c", "a", "b"} {
+		src.GeneralStream(integ.NonIncremental(name, struct{}{}), emitStream(nil))
+	}
+
+	for i := 0; i < 10; i++ {
+		out := handle(t, src, integ.CmdRead)
+		if c, a, b := strings.Index(out, `"name":"c"`), strings.Index(out, `"name":"a"`), strings.Index(out, `"name":"b"`); c < 0 || c > a || a > b {
+			t.Fatalf("expected streams in definition order: %s", out)
+		}
+	}
+}
+
+func TestInterleaved(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	src := integ.NewSource(struct{}{}).Concurrency(3)
+	for _, name := range []string{"a", "b", "c"} {
+		src.GeneralStream(integ.NonIncremental(name, struct{}{}), emitStream(&wg))
+	}
+
+	out := handle(t, src, integ.CmdRead)
+	if strings.Count(out, `"type":"RECORD"`) != 3 {
+		t.Errorf("expected a record per stream: %s", out)
+	}
+}
+
+func TestInterleavedDiscoverOrder(t *testing.T) {
+	src := integ.NewSource(struct{}{}).Interleaved()
+	for _, name := range []string{"c", "a", "b"} {
+		src.GeneralStream(integ.NonIncremental(name, struct{}{}), emitStream(nil))
+	}
+
+	for i := 0; i < 10; i++ {
+		out := handle(t, src, integ.CmdDiscover)
+		if c, a, b := strings.Index(out, `"name":"c"`), strings.Index(out, `"name":"a"`), strings.Index(out, `"name":"b"`); c < 0 || c > a || a > b {
+			t.Fatalf("expected the catalog in definition order: %s", out)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	forbidden := integ.GeneralRunnerFunc(func(ctx integ.GeneralContext) error {
+		return fmt.Errorf("403 Forbidden")
+	})
+	var emitted int
+	src := integ.NewSource(struct{}{}).
+		GeneralStream(integ.NonIncremental("customers", struct{}{}), emitStream(nil)).
+		GeneralStream(integ.NonIncremental("orders", struct{}{}), forbidden).
+		ManualRunner(integ.ManualRunnerFunc(func(ctx integ.ManualContext) error {
+			s, err := ctx.Stream(integ.NonIncremental("events", struct{}{}).Schema)
+			if err != nil {
+				return err
+			}
+			// the check stops at the first records
+			for ; emitted < 10; emitted++ {
+				if err := s.EmitValues([]*fastjson.Value{fastjson.MustParse(`{}`)}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+
+	out := handle(t, src, integ.CmdCheck)
+	if emitted != 0 {
+		t.Errorf("expected the manual runner to stop at the first record, emitted %d", emitted)
+	}
+	for _, expected := range []string{
+		`"log":"check customers: ok"`,
+		`"log":"check orders failed: 403 Forbidden"`,
+		`"log":"check manual runner: ok"`,
+		`"connection_status":{"status":"FAILED","reason":"validation failed: orders: 403 Forbidden"}`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %s: %s", expected, out)
+		}
+	}
+}
+
+func TestCheckManualFailure(t *testing.T) {
+	src := integ.NewSource(struct{}{}).
+		ManualRunner(integ.ManualRunnerFunc(func(ctx integ.ManualContext) error {
+			for _, name := range []string{"users", "orders"} {
+				if _, err := ctx.Stream(integ.NonIncremental(name, struct{}{}).Schema); err != nil {
+					return err
+				}
+			}
+			return fmt.Errorf("403 Forbidden")
+		}))
+
+	out := handle(t, src, integ.CmdCheck)
+	for _, expected := range []string{
+		`"log":"check manual runner failed: 403 Forbidden"`,
+		`"reason":"validation failed: manual runner: 403 Forbidden"`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %s: %s", expected, out)
+		}
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	src := integ.NewSource(struct {
+		ApiKey string `json:"api_key"`
+		Mode   string `json:"mode" enum:"full,delta"`
+		Limit  int    `json:"limit" default:"10"`
+	}{}).GeneralStream(integ.NonIncremental("customers", struct{}{}), emitStream(nil))
+
+	out := handle(t, src, integ.CmdCheck, `{"type":"CONFIG","config":{"apikey":"x","mode":"all","limit":"10","url":""}}`)
+	const expected = `"reason":"invalid config: api_key: missing required field; apikey: unknown field; mode: expected one of [full delta], got \"all\"; limit: expected integer, got string; url: unknown field"`
+	if !strings.Contains(out, expected) {
+		t.Errorf("expected %s: %s", expected, out)
+	} else if strings.Contains(out, "check customers") {
+		t.Errorf("expected no streams to be checked: %s", out)
+	}
+
+	if out := handle(t, src, integ.CmdCheck, `{"type":"CONFIG","config":{"api_key":"x","mode":"full"}}`); !strings.Contains(out, `"status":"SUCCEEDED"`) {
+		t.Errorf("expected valid config: %s", out)
+	}
+}
+
+func TestSpecConfig(t *testing.T) {
+	src := integ.NewSource(struct {
+		ApiKey string `json:"api_key"`
+		Mode   string `json:"mode" enum:"full,delta"`
+		Limit  int    `json:"limit" default:"10"`
+		Region string `json:"region" default:"eu"`
+	}{}).GeneralStream(integ.NonIncremental("customers", struct{}{}), emitStream(nil))
+
+	out := handle(t, src, integ.CmdSpec)
+	for _, expected := range []string{
+		`"mode":{"type":["string"],"enum":["full","delta"]}`,
+		`"limit":{"type":["integer"],"format":"i64","default":10}`,
+		`"region":{"type":["string"],"default":"eu"}`,
+		`"required":["api_key","mode"]`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %s: %s", expected, out)
+		}
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	type config struct {
+		Limit  int    `json:"limit" default:"10"`
+		Region string `json:"region" default:"eu"`
+	}
+	src := integ.NewSource(config{}).
+		GeneralStream(integ.NonIncremental("config", config{}), integ.GeneralRunnerFunc(func(ctx integ.GeneralContext) error {
+			var cnf config
+			if err := ctx.Load(&cnf, nil); err != nil {
+				return err
+			}
+			return ctx.EmitValue(cnf)
+		}))
+
+	out := handle(t, src, integ.CmdRead, `{"type":"CONFIG","config":{"region":"us"}}`)
+	if expected := `"data":{"limit":10,"region":"us"}`; !strings.Contains(out, expected) {
+		t.Errorf("expected %s: %s", expected, out)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	type user struct {
+		Id int `json:"id"`
+	}
+	err := integ.NewSource(struct{ Extra interface{} }{}).
+		HttpStream(integ.NonIncremental("users", user{}).Primary(integ.Field("uid"))).
+		GeneralStream(integ.Incremental("users", user{}), emitStream(nil)).
+		Validate()
+
+	const expected = "config: field Extra has no json type; " +
+		"stream users: no runner, provide a runner or set the shared HttpRunner before the stream; " +
+		"stream users: primary key field [uid] does not exist; " +
+		"stream users: duplicate stream name; " +
+		"stream users: incremental stream without cursor"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %s, got %v", expected, err)
+	}
+
+	// the source is validated before the command is handled
+	src := integ.NewSource(struct{}{}).GeneralStream(integ.Incremental("users", user{}), emitStream(nil))
+	var w bytes.Buffer
+	err = src.Handle(context.Background(), integ.CmdSpec, &w, strings.NewReader(""), integ.Protos{"": airbyte.Airbyte})
+	if err == nil || err.Error() != "invalid source: stream users: incremental stream without cursor" || w.Len() != 0 {
+		t.Errorf("expected the invalid source to fail, got %v: %s", err, w.String())
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	panicking := integ.GeneralRunnerFunc(func(ctx integ.GeneralContext) error {
+		var m map[string]int
+		m["x"]++ // nil map
+		return nil
+	})
+	fanOut := integ.GeneralRunnerFunc(func(ctx integ.GeneralContext) error {
+		return ctx.FanOut(2, 2, func(i int) error {
+			if i == 1 {
+				panic("fan out")
+			}
+			return nil
+		})
+	})
+
+	for _, interleaved := range []bool{false, true} {
+		src := integ.NewSource(struct{}{}).
+			GeneralStream(integ.NonIncremental("users", struct{}{}), panicking).
+			GeneralStream(integ.NonIncremental("orders", struct{}{}), fanOut).
+			GeneralStream(integ.NonIncremental("items", struct{}{}), emitStream(nil))
+		if interleaved {
+			src.Interleaved()
+		}
+
+		var w bytes.Buffer
+		err := src.Handle(context.Background(), integ.CmdRead, &w, strings.NewReader(""), integ.Protos{"": airbyte.Airbyte})
+		if err == nil || !strings.Contains(err.Error(), "stream users: panic: assignment to entry in nil map") || !strings.Contains(err.Error(), "stream orders: panic: fan out") {
+			t.Errorf("expected the panics to fail the sync, got %v", err)
+		}
+
+		out := w.String()
+		for _, s := range []string{
+			`"record":{"stream":"items"`,
+			`"stream_status":{"stream_descriptor":{"name":"items"},"status":"COMPLETE"}`,
+			`"stream_status":{"stream_descriptor":{"name":"users"},"status":"INCOMPLETE"}`,
+			`"stack_trace":"goroutine`,
+		} {
+			if !strings.Contains(out, s) {
+				t.Errorf("interleaved %v: expected %s in %s", interleaved, s, out)
+			}
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic when recovery is disabled")
+		}
+	}()
+	src := integ.NewSource(struct{}{}).RecoverPanics(false).GeneralStream(integ.NonIncremental("users", struct{}{}), panicking)
+	_ = src.Handle(context.Background(), integ.CmdRead, io.Discard, strings.NewReader(""), integ.Protos{"": airbyte.Airbyte})
+}
@@ -0,0 +1,84 @@
+package integ
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// StateMigration upgrades a state from version n to n+1
+type StateMigration func(old json.RawMessage) (json.RawMessage, error)
+
+// StateDef defines a versioned state of type S. The state is stored as {"version":n,"state":{...}}, a state
+// without version is version 0. Older states are upgraded by the migrations, newer states are rejected
+type StateDef[S any] struct {
+	version    int
+	migrations map[int]StateMigration
+}
+
+type versionedState struct {
+	Version int         `json:"version"`
+	State   interface{} `json:"state"`
+}
+
+// NewState defines the current version of the state
+func NewState[S any](version int) *StateDef[S] {
+	return &StateDef[S]{version: version, migrations: map[int]StateMigration{}}
+}
+
+// Migrate registers the migration of states from version from to from+1
+func (d *StateDef[S]) Migrate(from int, fn StateMigration) *StateDef[S] {
+	d.migrations[from] = fn
+	return d
+}
+
+// Load loads the config and the state, the state is upgraded to the current version.
+// The zero state is returned if no state is provided
+func (d *StateDef[S]) Load(ctx GeneralContext, config interface{}) (S, error) {
+	var state S
+	var raw json.RawMessage
+	if err := ctx.Load(config, &raw); err != nil || len(raw) == 0 || string(raw) == "null" {
+		return state, err
+	}
+
+	var envelope struct {
+		Version *int            `json:"version"`
+		State   json.RawMessage `json:"state"`
+	}
+	var version int
+	if err := json.Unmarshal(raw, &envelope); err == nil && envelope.Version != nil && envelope.State != nil {
+		version, raw = *envelope.Version, envelope.State
+	}
+
+	if version > d.version {
+		return state, fmt.Errorf("state version %d is newer than the supported version %d", version, d.version)
+	}
+	for ; version < d.version; version++ {
+		fn, ok := d.migrations[version]
+		if !ok {
+			return state, fmt.Errorf("no migration of state version %d", version)
+		}
+		var err error
+		if raw, err = fn(raw); err != nil {
+			return state, fmt.Errorf("migrate state version %d: %w", version, err)
+		}
+	}
+
+	// unknown fields indicate a state of another shape, that would decode to a zero state
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&state); err != nil {
+		return state, fmt.Errorf("invalid state (version %d): %w", d.version, err)
+	}
+	return state, nil
+}
+
+// Emit emits the state with the current version
+func (d *StateDef[S]) Emit(ctx GeneralContext, state S) error {
+	return ctx.EmitState(versionedState{Version: d.version, State: state})
+}
+
+// SetCursor registers the state with the current version, it is emitted at the next checkpoint
+func (d *StateDef[S]) SetCursor(ctx HttpContext, state S) {
+	ctx.SetCursor(versionedState{Version: d.version, State: state})
+}
@@ -0,0 +1,61 @@
+package integ_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ajzo90/go-integ"
+	"github.com/ajzo90/go-integ/pkg/airbyte"
+)
+
+func TestStateDef(t *testing.T) {
+	type state struct {
+		Cursor int `json:"cursor"`
+	}
+	def := integ.NewState[state](1).Migrate(0, func(old json.RawMessage) (json.RawMessage, error) {
+		var v0 struct{ Last int }
+		if err := json.Unmarshal(old, &v0); err != nil {
+			return nil, err
+		}
+		return json.Marshal(state{Cursor: v0.Last})
+	})
+
+	src := integ.NewSource(struct{}{}).
+		GeneralStream(integ.NonIncremental("users", struct{}{}), integ.GeneralRunnerFunc(func(ctx integ.GeneralContext) error {
+			st, err := def.Load(ctx, nil)
+			if err != nil {
+				return err
+			}
+			st.Cursor++
+			return def.Emit(ctx, st)
+		}))
+
+	for _, c := range []struct{ state, expected string }{
+		{``, `"stream_state":{"version":1,"state":{"cursor":1}}`},
+		{`{"Last":5}`, `"stream_state":{"version":1,"state":{"cursor":6}}`},
+		{`{"version":1,"state":{"cursor":7}}`, `"stream_state":{"version":1,"state":{"cursor":8}}`},
+		{`{"version":2,"state":{"cursor":7}}`, `"log":"state version 2 is newer than the supported version 1"`},
+		{`{"version":1,"state":{"last":7}}`, `"log":"invalid state (version 1): json: unknown field \"last\""`},
+	} {
+		var input []string
+		if c.state != "" {
+			input = append(input, `{"type":"STATE","stream":"users","state":`+c.state+`}`)
+		}
+		if out := handle(t, src, integ.CmdRead, input...); !strings.Contains(out, c.expected) {
+			t.Errorf("state %s: expected %s: %s", c.state, c.expected, out)
+		}
+	}
+}
+
+func TestMalformedGlobalState(t *testing.T) {
+	src := integ.NewSource(struct{}{}).
+		GeneralStream(integ.NonIncremental("users", struct{}{}), emitStream(nil))
+
+	var w strings.Builder
+	err := src.Handle(context.Background(), integ.CmdRead, &w, strings.NewReader(`{"type":"STATE","state":"x"}`), integ.Protos{"": airbyte.Airbyte})
+	if err == nil || !strings.Contains(err.Error(), "cannot unmarshal string") {
+		t.Errorf("expected a state error, got %v", err)
+	}
+}
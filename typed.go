@@ -0,0 +1,117 @@
+package integ
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ajzo90/go-requests"
+	"github.com/valyala/fastjson"
+)
+
+// FastJSONMarshaler encodes a record without reflection, the value is allocated in the arena
+type FastJSONMarshaler interface {
+	MarshalFastJSON(a *fastjson.Arena) *fastjson.Value
+}
+
+// TypedHttpContext is the context of typed http streams, with records of type T, config C and state S
+type TypedHttpContext[T FastJSONMarshaler, C, S any] interface {
+	Schema() Schema
+
+	// Configured returns the sync configuration selected for the stream
+	Configured() ConfiguredStream
+
+	// Load returns the config and the state of the stream, the zero state if no state is provided
+	Load() (C, S, error)
+
+	// Emit encodes and emits the records
+	Emit(records ...T) error
+
+	// EmitState emit the state
+	EmitState(state S) error
+
+	// SetCursor registers the current state, it is emitted at the next checkpoint
+	SetCursor(state S)
+
+	// CheckpointEvery sets the checkpoint policy, see HttpContext
+	CheckpointEvery(records int, interval time.Duration)
+
+	EmitLog(v any) error
+
+	// EmitEstimate reports the estimated number of records and bytes of the stream, see GeneralContext
+	EmitEstimate(rows, bytes int64) error
+
+	// EmitBatch executes the request and emit the untyped records, see HttpContext
+	EmitBatch(req *requests.Request, resp *requests.JSONResponse, keys ...string) error
+}
+
+type TypedHttpRunnerFunc[T FastJSONMarshaler, C, S any] func(ctx TypedHttpContext[T, C, S]) error
+
+// TypedHttpStream defines a http stream with records of type T, config C and state S:
+//
+//	integ.TypedHttpStream(src, schema, func(ctx integ.TypedHttpContext[order, config, state]) error {...})
+func TypedHttpStream[T FastJSONMarshaler, C, S any](src *sourceDef, schema SchemaBuilder, fn TypedHttpRunnerFunc[T, C, S]) *sourceDef {
+	return src.HttpStream(schema, TypedHttpRunner(fn))
+}
+
+// TypedHttpRunner adapts a typed runner to a HttpRunner, see TypedHttpStream:
+//
+//	src.HttpStream(schema, integ.TypedHttpRunner(func(ctx integ.TypedHttpContext[order, config, state]) error {...}))
+func TypedHttpRunner[T FastJSONMarshaler, C, S any](fn TypedHttpRunnerFunc[T, C, S]) HttpRunner {
+	return typedHttpRunner[T, C, S](fn)
+}
+
+type typedHttpRunner[T FastJSONMarshaler, C, S any] TypedHttpRunnerFunc[T, C, S]
+
+func (fn typedHttpRunner[T, C, S]) Run(ctx HttpContext) error {
+	return fn(&typedHttpContext[T, C, S]{HttpContext: ctx})
+}
+
+// validateSchema checks that the keys emitted by MarshalFastJSON are defined in the schema, once in Validate
+// and not per record. The zero record is encoded, fields omitted when empty are not checked
+func (fn typedHttpRunner[T, C, S]) validateSchema(schema Schema) error {
+	var record T
+	if t := reflect.TypeOf(record); t != nil && t.Kind() == reflect.Ptr {
+		record = reflect.New(t.Elem()).Interface().(T)
+	}
+	js, err := newJsonSchema(schema.JsonSchema)
+	if err != nil {
+		return err
+	}
+	var a fastjson.Arena
+	if unknown := js.unknownKeys(record.MarshalFastJSON(&a), "", nil); len(unknown) > 0 {
+		return fmt.Errorf("stream %s: %T.MarshalFastJSON emits fields not in the schema: %s", schema.Name, record, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+type typedHttpContext[T FastJSONMarshaler, C, S any] struct {
+	HttpContext
+	arena  fastjson.Arena
+	values []*fastjson.Value
+}
+
+func (c *typedHttpContext[T, C, S]) Load() (C, S, error) {
+	var config C
+	var state S
+	err := c.HttpContext.Load(&config, &state)
+	return config, state, err
+}
+
+func (c *typedHttpContext[T, C, S]) Emit(records ...T) error {
+	c.arena.Reset()
+	c.values = c.values[:0]
+	for _, r := range records {
+		c.values = append(c.values, r.MarshalFastJSON(&c.arena))
+	}
+	return c.HttpContext.EmitValues(c.values)
+}
+
+func (c *typedHttpContext[T, C, S]) EmitState(state S) error {
+	return c.HttpContext.EmitState(state)
+}
+
+func (c *typedHttpContext[T, C, S]) SetCursor(state S) {
+	c.HttpContext.SetCursor(state)
+}
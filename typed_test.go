@@ -0,0 +1,71 @@
+package integ_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ajzo90/go-integ"
+	"github.com/valyala/fastjson"
+)
+
+type typedOrder struct {
+	Id    int    `json:"id"`
+	Email string `json:"email"`
+}
+
+func (o typedOrder) MarshalFastJSON(a *fastjson.Arena) *fastjson.Value {
+	v := a.NewObject()
+	v.Set("id", a.NewNumberInt(o.Id))
+	v.Set("email", a.NewString(o.Email))
+	return v
+}
+
+func TestTypedHttpStream(t *testing.T) {
+	type config struct {
+		Url string `json:"url"`
+	}
+	type state struct {
+		Last int `json:"last"`
+	}
+
+	src := integ.TypedHttpStream(integ.NewSource(config{}), integ.Incremental("orders", typedOrder{}).OrderBy(integ.Field("id")), func(ctx integ.TypedHttpContext[typedOrder, config, state]) error {
+		cnf, st, err := ctx.Load()
+		if err != nil {
+			return err
+		} else if err := ctx.Emit(typedOrder{Id: st.Last + 1, Email: cnf.Url}, typedOrder{Id: st.Last + 2}); err != nil {
+			return err
+		}
+		return ctx.EmitState(state{Last: st.Last + 2})
+	})
+
+	out := handle(t, src, integ.CmdRead, `{"type":"CONFIG","config":{"url":"x"}}`, `{"type":"STATE","stream":"orders","state":{"last":1}}`)
+	for _, expected := range []string{`"data":{"id":2,"email":"x"}`, `"data":{"id":3,"email":""}`, `"stream_state":{"last":3}`} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %s: %s", expected, out)
+		}
+	}
+}
+
+// untaggedOrder encodes keys that differ from the field names in the schema
+type untaggedOrder struct {
+	Id int
+}
+
+func (o untaggedOrder) MarshalFastJSON(a *fastjson.Arena) *fastjson.Value {
+	v := a.NewObject()
+	v.Set("id", a.NewNumberInt(o.Id))
+	return v
+}
+
+func TestTypedHttpRunnerUnknownKeys(t *testing.T) {
+	err := integ.NewSource(struct{}{}).
+		HttpStream(integ.NonIncremental("orders", untaggedOrder{}), integ.TypedHttpRunner(func(ctx integ.TypedHttpContext[untaggedOrder, struct{}, struct{}]) error {
+			return ctx.Emit(untaggedOrder{Id: 1})
+		})).
+		Validate()
+
+	const expected = "stream orders: integ_test.untaggedOrder.MarshalFastJSON emits fields not in the schema: id"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %s, got %v", expected, err)
+	}
+}
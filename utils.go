@@ -1,6 +1,7 @@
 package integ
 
 import (
+	"io"
 	"net/http"
 	"sort"
 	"strings"
@@ -32,7 +33,47 @@ func Keys(schema *jsonschema.Document) []string {
 	return o
 }
 
+// DefaultRetryer retries rate limited and failed requests, the errors are categorized, see HTTPError.
+// Note that the retryer of go-requests only accepts 200, use CategorizeErrors directly for apis responding with 201/204
 func DefaultRetryer() requests.Doer {
-	return requests.NewRetryer(http.DefaultClient, requests.Logger(func(id int, err error, msg string) {
-	}))
+	return CategorizeErrors(requests.NewRetryer(http.DefaultClient, requests.Logger(func(id int, err error, msg string) {
+	})))
+}
+
+// CategorizeErrors categorizes the errors of unsuccessful responses (not 2xx) by the status code, see HTTPError
+func CategorizeErrors(doer requests.Doer) requests.Doer {
+	return categorizingDoer{doer: doer}
+}
+
+type categorizingDoer struct {
+	doer requests.Doer
+}
+
+func (d categorizingDoer) Do(r *http.Request) (*http.Response, error) {
+	resp, err := d.doer.Do(r)
+	if resp != nil && (err != nil || resp.StatusCode < 200 || resp.StatusCode > 299) {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+		return nil, HTTPError(resp, err)
+	}
+	return resp, err
+}
+
+// errorList aggregates multiple errors into one
+type errorList []error
+
+func (e errorList) Error() string {
+	var s = make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// err returns nil if the list is empty
+func (e errorList) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
 }
@@ -0,0 +1,382 @@
+package integ
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ajzo90/go-jsonschema-generator"
+	"github.com/valyala/fastjson"
+)
+
+// jsonSchema is the subset of json schema used to validate values, and the spec of the config
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Type                 []string               `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties bool                   `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+}
+
+func newJsonSchema(doc *jsonschema.Document) (*jsonSchema, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var s jsonSchema
+	return &s, json.Unmarshal(b, &s)
+}
+
+// configSchema returns the schema of the config, see specSchema
+func configSchema(config interface{}) (*jsonSchema, error) {
+	return specSchema(jsonschema.New(config), config)
+}
+
+// specSchema returns the spec document of the config, extended with the struct tags
+// enum:"a,b" (allowed values) and default:"x" (not required, see applyDefaults)
+func specSchema(doc *jsonschema.Document, config interface{}) (*jsonSchema, error) {
+	s, err := newJsonSchema(doc)
+	if err != nil {
+		return nil, err
+	}
+	s.applyTags(reflect.TypeOf(config))
+	return s, nil
+}
+
+func (s *jsonSchema) applyTags(t reflect.Type) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		if t.Kind() == reflect.Slice && s.Items != nil {
+			s = s.Items
+		}
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := jsonName(field)
+		if name == "-" {
+			continue
+		} else if field.Anonymous {
+			s.applyTags(field.Type)
+			continue
+		}
+
+		prop := s.Properties[name]
+		if prop == nil {
+			continue
+		}
+		if enum, ok := field.Tag.Lookup("enum"); ok {
+			for _, v := range strings.Split(enum, ",") {
+				prop.Enum = append(prop.Enum, v)
+			}
+		}
+		if def, ok := field.Tag.Lookup("default"); ok {
+			s.Required = remove(s.Required, name)
+			prop.Default = prop.value(def)
+		}
+		prop.applyTags(field.Type)
+	}
+}
+
+// value converts the tag value s to the json type of the property, s is kept as string if not a valid value
+func (s *jsonSchema) value(str string) interface{} {
+	for _, typ := range s.Type {
+		var v interface{}
+		if typ != "string" && typ != "null" && json.Unmarshal([]byte(str), &v) == nil {
+			return v
+		}
+	}
+	return str
+}
+
+// applyDefaults sets the fields of the struct v points to with a default:"x" tag to the default value,
+// the fields are then overwritten by the decoded config
+func applyDefaults(v reflect.Value) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || jsonName(field) == "-" {
+			continue
+		}
+		f := v.Field(i)
+		if def, ok := field.Tag.Lookup("default"); !ok {
+			if err := applyDefaults(f.Addr()); err != nil {
+				return err
+			}
+		} else if f.Kind() == reflect.String {
+			f.SetString(def)
+		} else if err := json.Unmarshal([]byte(def), f.Addr().Interface()); err != nil {
+			return fmt.Errorf("default of %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+// jsonName is the name of the field in json, as used by the schema generator
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// validateConfigSpec checks that the config type produce a valid spec, an object where all fields have a type
+func validateConfigSpec(config interface{}) error {
+	if config == nil {
+		return fmt.Errorf("config: missing config type")
+	}
+	s, err := configSchema(config)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	} else if len(s.Type) != 1 || s.Type[0] != "object" {
+		return fmt.Errorf("config: expected a struct, got %T", config)
+	}
+
+	var errs errorList
+	for _, p := range s.untyped("", nil) {
+		errs = append(errs, fmt.Errorf("config: field %s has no json type", p))
+	}
+	return errs.err()
+}
+
+// untyped returns the paths of the properties without type
+func (s *jsonSchema) untyped(path string, out []string) []string {
+	if len(s.Type) == 0 && path != "" {
+		return append(out, path)
+	} else if s.Items != nil {
+		out = s.Items.untyped(path+"[]", out)
+	}
+	var keys []string
+	for k := range s.Properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		out = s.Properties[k].untyped(join(path, k), out)
+	}
+	return out
+}
+
+// unknownKeys returns the paths of the object keys in v that are not defined in the schema, maps and untyped
+// values accept any key
+func (s *jsonSchema) unknownKeys(v *fastjson.Value, path string, out []string) []string {
+	if len(s.Type) == 0 {
+		return out
+	}
+	switch v.Type() {
+	case fastjson.TypeObject:
+		v.GetObject().Visit(func(key []byte, v *fastjson.Value) {
+			if prop, ok := s.Properties[string(key)]; ok {
+				out = prop.unknownKeys(v, join(path, string(key)), out)
+			} else if prop, ok := s.Properties[".*"]; ok {
+				out = prop.unknownKeys(v, join(path, string(key)), out)
+			} else if !s.AdditionalProperties {
+				out = append(out, join(path, string(key)))
+			}
+		})
+	case fastjson.TypeArray:
+		if s.Items != nil {
+			for _, item := range v.GetArray() {
+				out = s.Items.unknownKeys(item, path+"[]", out)
+			}
+		}
+	}
+	return out
+}
+
+// hasPath returns true if the property at path is defined, arrays are traversed
+func (s *jsonSchema) hasPath(path []string) bool {
+	for _, k := range path {
+		for s.Items != nil {
+			s = s.Items
+		}
+		if s = s.Properties[k]; s == nil {
+			return false
+		}
+	}
+	return len(path) > 0
+}
+
+func remove(arr []string, s string) []string {
+	var out = arr[:0]
+	for _, v := range arr {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+type validationError struct {
+	path string
+	msg  string
+}
+
+func (e validationError) Error() string {
+	if e.path == "" {
+		return e.msg
+	}
+	return e.path + ": " + e.msg
+}
+
+// validator validates json values against a schema
+type validator struct {
+	// strict disallows properties not defined in the schema
+	strict bool
+	// foldCase matches property names case-insensitive, like encoding/json
+	foldCase bool
+}
+
+func (vd validator) validate(s *jsonSchema, v *fastjson.Value) []error {
+	return vd.validateValue(s, v, "", nil)
+}
+
+func (vd validator) validateValue(s *jsonSchema, v *fastjson.Value, path string, errs []error) []error {
+	if s == nil {
+		return errs
+	} else if !s.hasType(v) {
+		return append(errs, validationError{path: path, msg: fmt.Sprintf("expected %s, got %s", strings.Join(s.Type, " or "), typeName(v))})
+	} else if len(s.Enum) > 0 && !s.inEnum(v) {
+		return append(errs, validationError{path: path, msg: fmt.Sprintf("expected one of %v, got %s", s.Enum, v.String())})
+	} else if s.Format == "date-time" && v.Type() == fastjson.TypeString {
+		if _, err := time.Parse(time.RFC3339, string(v.GetStringBytes())); err != nil {
+			errs = append(errs, validationError{path: path, msg: "expected date-time (RFC3339)"})
+		}
+	}
+
+	switch v.Type() {
+	case fastjson.TypeObject:
+		o := v.GetObject()
+		for _, req := range s.Required {
+			if vd.lookup(o, req) == nil {
+				errs = append(errs, validationError{path: join(path, req), msg: "missing required field"})
+			}
+		}
+		o.Visit(func(key []byte, v *fastjson.Value) {
+			if prop := vd.property(s, string(key)); prop != nil {
+				errs = vd.validateValue(prop, v, join(path, string(key)), errs)
+			} else if vd.strict && s.Properties != nil {
+				errs = append(errs, validationError{path: join(path, string(key)), msg: "unknown field"})
+			}
+		})
+	case fastjson.TypeArray:
+		for i, item := range v.GetArray() {
+			errs = vd.validateValue(s.Items, item, path+"["+strconv.Itoa(i)+"]", errs)
+		}
+	}
+	return errs
+}
+
+func (vd validator) lookup(o *fastjson.Object, key string) *fastjson.Value {
+	if v := o.Get(key); v != nil || !vd.foldCase {
+		return v
+	}
+	var found *fastjson.Value
+	o.Visit(func(k []byte, v *fastjson.Value) {
+		if found == nil && strings.EqualFold(string(k), key) {
+			found = v
+		}
+	})
+	return found
+}
+
+func (vd validator) property(s *jsonSchema, key string) *jsonSchema {
+	if p, ok := s.Properties[key]; ok {
+		return p
+	} else if p, ok := s.Properties[".*"]; ok {
+		return p // map
+	} else if vd.foldCase {
+		for k, p := range s.Properties {
+			if strings.EqualFold(k, key) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+func (s *jsonSchema) hasType(v *fastjson.Value) bool {
+	if len(s.Type) == 0 {
+		return true
+	}
+	for _, typ := range s.Type {
+		if isType(typ, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func isType(typ string, v *fastjson.Value) bool {
+	switch typ {
+	case "string":
+		return v.Type() == fastjson.TypeString
+	case "integer":
+		f, err := v.Float64()
+		return err == nil && v.Type() == fastjson.TypeNumber && f == math.Trunc(f)
+	case "number":
+		return v.Type() == fastjson.TypeNumber
+	case "boolean":
+		return v.Type() == fastjson.TypeTrue || v.Type() == fastjson.TypeFalse
+	case "object":
+		return v.Type() == fastjson.TypeObject
+	case "array":
+		return v.Type() == fastjson.TypeArray
+	case "null":
+		return v.Type() == fastjson.TypeNull
+	default:
+		return true
+	}
+}
+
+func (s *jsonSchema) inEnum(v *fastjson.Value) bool {
+	for _, e := range s.Enum {
+		if str, ok := e.(string); ok {
+			if v.Type() == fastjson.TypeString && string(v.GetStringBytes()) == str {
+				return true
+			}
+		} else if b, err := json.Marshal(e); err == nil && string(b) == v.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func typeName(v *fastjson.Value) string {
+	switch v.Type() {
+	case fastjson.TypeTrue, fastjson.TypeFalse:
+		return "boolean"
+	default:
+		return v.Type().String()
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}